@@ -0,0 +1,190 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.uber.org/zap"
+)
+
+// Client is the part of the CloudWatch API used by CloudWatchMetricSender,
+// implemented by *cloudwatch.Client.
+type Client interface {
+	PutMetricData(ctx context.Context, params *cloudwatch.PutMetricDataInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error)
+}
+
+type Dimension = struct {
+	Name  string
+	Value string
+}
+
+type CloudWatchMetric struct {
+	Namespace  string
+	MetricName string
+	Unit       string
+	Dimensions []Dimension
+	Value      float64
+}
+
+type CloudWatchMetricSender struct {
+	cli    Client
+	m      sync.Mutex
+	batch  map[string][]types.MetricDatum
+	logger *zap.Logger
+	ticker *time.Ticker
+	done   chan struct{}
+	stop   sync.Once
+	wg     sync.WaitGroup
+}
+
+const maxMetricsPerRequest = 20
+
+// New creates a sender. With a batchFrequency the metrics are collected per
+// namespace and sent once 20 of them are pending or the ticker fires,
+// otherwise Send puts every metric on its own.
+func New(cli Client, batchFrequency time.Duration, opts ...func(l *CloudWatchMetricSender)) (*CloudWatchMetricSender, error) {
+	zapConf := zap.NewProductionConfig()
+	logger, err := zapConf.Build(zap.AddStacktrace(zap.FatalLevel))
+	if err != nil {
+		return nil, err
+	}
+	l := &CloudWatchMetricSender{
+		cli:    cli,
+		logger: logger,
+		done:   make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	if batchFrequency > 0 {
+		l.batch = map[string][]types.MetricDatum{}
+		l.ticker = time.NewTicker(batchFrequency)
+		l.wg.Add(1)
+		go l.sendBatches()
+	}
+
+	return l, nil
+}
+
+func WithLogger(logger *zap.Logger) func(l *CloudWatchMetricSender) {
+	return func(l *CloudWatchMetricSender) {
+		l.logger = logger
+	}
+}
+
+func (s *CloudWatchMetricSender) Send(m CloudWatchMetric) error {
+	return s.SendContext(context.Background(), m)
+}
+
+// SendContext is Send bounded by ctx, which is only used without batching.
+func (s *CloudWatchMetricSender) SendContext(ctx context.Context, m CloudWatchMetric) error {
+	md := types.MetricDatum{
+		MetricName: aws.String(m.MetricName),
+		Unit:       types.StandardUnit(m.Unit),
+		Value:      aws.Float64(m.Value),
+		Dimensions: []types.Dimension{},
+	}
+
+	for _, d := range m.Dimensions {
+		md.Dimensions = append(md.Dimensions, types.Dimension{
+			Name:  aws.String(d.Name),
+			Value: aws.String(d.Value),
+		})
+	}
+
+	if s.batch == nil {
+		_, err := s.cli.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(m.Namespace),
+			MetricData: []types.MetricDatum{md},
+		})
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.batch[m.Namespace] = append(s.batch[m.Namespace], md)
+	if len(s.batch[m.Namespace]) >= maxMetricsPerRequest {
+		batch := s.batch[m.Namespace]
+		s.batch[m.Namespace] = nil
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.logError(m.Namespace, s.sendBatch(context.Background(), m.Namespace, batch))
+		}()
+	}
+	return nil
+}
+
+func (s *CloudWatchMetricSender) sendBatches() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.ticker.C:
+			_ = s.Sync()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Sync sends all pending metrics and returns the errors of the failed
+// requests.
+func (s *CloudWatchMetricSender) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+// SyncContext is Sync bounded by ctx.
+func (s *CloudWatchMetricSender) SyncContext(ctx context.Context) error {
+	s.m.Lock()
+	batches := s.batch
+	if batches != nil {
+		s.batch = map[string][]types.MetricDatum{}
+	}
+	s.m.Unlock()
+
+	var errs []error
+	for n, b := range batches {
+		err := s.sendBatch(ctx, n, b)
+		s.logError(n, err)
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the batch ticker and sends the pending metrics.
+func (s *CloudWatchMetricSender) Close(ctx context.Context) error {
+	if s.ticker != nil {
+		s.stop.Do(func() {
+			s.ticker.Stop()
+			close(s.done)
+		})
+	}
+	s.wg.Wait()
+	return s.SyncContext(ctx)
+}
+
+func (s *CloudWatchMetricSender) sendBatch(ctx context.Context, namespace string, batch []types.MetricDatum) error {
+	var errs []error
+	for start := 0; start < len(batch); start += maxMetricsPerRequest {
+		end := min(start+maxMetricsPerRequest, len(batch))
+		_, err := s.cli.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+			Namespace:  aws.String(namespace),
+			MetricData: batch[start:end],
+		})
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *CloudWatchMetricSender) logError(namespace string, err error) {
+	if err != nil {
+		s.logger.Warn("failed to PutMetricData", zap.String("namespace", namespace), zap.Error(err))
+	}
+}
@@ -0,0 +1,105 @@
+package v2
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.uber.org/zap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockClient struct {
+	m      sync.Mutex
+	inputs []*cloudwatch.PutMetricDataInput
+	err    error
+}
+
+func (c *mockClient) PutMetricData(_ context.Context, params *cloudwatch.PutMetricDataInput, _ ...func(*cloudwatch.Options)) (*cloudwatch.PutMetricDataOutput, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.inputs = append(c.inputs, params)
+	return &cloudwatch.PutMetricDataOutput{}, c.err
+}
+
+func (c *mockClient) requests() []*cloudwatch.PutMetricDataInput {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return append([]*cloudwatch.PutMetricDataInput{}, c.inputs...)
+}
+
+func TestCloudWatchMetricSender_Send(t *testing.T) {
+	client := &mockClient{}
+	metricSender, err := New(client, 0, WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+
+	err = metricSender.Send(CloudWatchMetric{
+		Namespace:  "test",
+		MetricName: "test",
+		Unit:       "Count",
+		Dimensions: []Dimension{{Name: "Service", Value: "api"}},
+		Value:      42,
+	})
+	require.NoError(t, err)
+
+	requests := client.requests()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "test", aws.ToString(requests[0].Namespace))
+	assert.Equal(t, []types.MetricDatum{{
+		MetricName: aws.String("test"),
+		Unit:       types.StandardUnitCount,
+		Value:      aws.Float64(42),
+		Dimensions: []types.Dimension{{Name: aws.String("Service"), Value: aws.String("api")}},
+	}}, requests[0].MetricData)
+
+	client.err = errors.New("throttled")
+	assert.ErrorIs(t, metricSender.Send(CloudWatchMetric{Namespace: "test", MetricName: "test"}), client.err)
+}
+
+func TestCloudWatchMetricSender_Batch(t *testing.T) {
+	client := &mockClient{}
+	metricSender, err := New(client, time.Hour, WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+
+	for i := 0; i < 45; i++ {
+		require.NoError(t, metricSender.Send(CloudWatchMetric{Namespace: "a", MetricName: "test_batch", Value: float64(i)}))
+	}
+	require.NoError(t, metricSender.Send(CloudWatchMetric{Namespace: "b", MetricName: "test_batch"}))
+	require.NoError(t, metricSender.Close(context.Background()))
+
+	var sizes []int
+	for _, r := range client.requests() {
+		sizes = append(sizes, len(r.MetricData))
+	}
+	sort.Ints(sizes)
+	assert.Equal(t, []int{1, 5, 20, 20}, sizes)
+}
+
+func TestCloudWatchMetricSender_Ticker(t *testing.T) {
+	client := &mockClient{}
+	metricSender, err := New(client, 10*time.Millisecond, WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+	defer metricSender.Close(context.Background())
+
+	require.NoError(t, metricSender.Send(CloudWatchMetric{Namespace: "test", MetricName: "test_ticker"}))
+	assert.Eventually(t, func() bool { return len(client.requests()) == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestCloudWatchMetricSender_SyncError(t *testing.T) {
+	client := &mockClient{err: errors.New("throttled")}
+	metricSender, err := New(client, time.Hour, WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+
+	require.NoError(t, metricSender.Send(CloudWatchMetric{Namespace: "test", MetricName: "test"}))
+	assert.ErrorIs(t, metricSender.Sync(), client.err)
+	assert.NoError(t, metricSender.Sync())
+	assert.NoError(t, metricSender.Close(context.Background()))
+}
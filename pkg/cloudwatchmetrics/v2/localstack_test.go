@@ -0,0 +1,61 @@
+//go:build integration
+
+package v2
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"go.uber.org/zap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLocalStack runs against the LocalStack at LOCALSTACK_ENDPOINT, e.g.
+// started with testcontainers.StartLocalStack or docker run localstack/localstack.
+func TestLocalStack(t *testing.T) {
+	endpoint := os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://localhost:4566"
+	}
+	client := cloudwatch.New(cloudwatch.Options{
+		Region:       "eu-central-1",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	})
+	metricSender, err := New(client, time.Hour, WithLogger(zap.NewNop()))
+	require.NoError(t, err)
+
+	start := time.Now().Add(-time.Minute)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, metricSender.Send(CloudWatchMetric{
+			Namespace:  "test",
+			MetricName: "test_batch",
+			Unit:       "Count",
+			Dimensions: []Dimension{{Name: "Service", Value: "api"}},
+			Value:      1,
+		}))
+	}
+	require.NoError(t, metricSender.Close(context.Background()))
+
+	assert.Eventually(t, func() bool {
+		out, err := client.GetMetricStatistics(context.Background(), &cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("test"),
+			MetricName: aws.String("test_batch"),
+			Dimensions: []types.Dimension{{Name: aws.String("Service"), Value: aws.String("api")}},
+			StartTime:  aws.Time(start),
+			EndTime:    aws.Time(time.Now().Add(time.Minute)),
+			Period:     aws.Int32(3600),
+			Statistics: []types.Statistic{types.StatisticSum},
+		})
+		return err == nil && len(out.Datapoints) == 1 && aws.ToFloat64(out.Datapoints[0].Sum) == 25
+	}, 30*time.Second, time.Second)
+}
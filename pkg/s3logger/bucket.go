@@ -0,0 +1,197 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+var (
+	// ErrBucketNotFound is returned if the bucket does not exist.
+	ErrBucketNotFound = errors.New("s3logger: bucket not found")
+	// ErrAccessDenied is returned if the credentials may not use the bucket.
+	ErrAccessDenied = errors.New("s3logger: access to bucket denied")
+)
+
+// BucketCheck is how New verifies the bucket.
+type BucketCheck int
+
+const (
+	// BucketCheckHead calls HeadBucket, the default.
+	BucketCheckHead BucketCheck = iota
+	// BucketCheckNone skips the check.
+	BucketCheckNone
+	// BucketCheckWriteProbe puts an empty probe object below the prefix with
+	// the server-side encryption of the chunks, which also verifies the write
+	// permission. The probe object is deleted afterwards if the client has a
+	// DeleteObject method and the credentials allow it.
+	BucketCheckWriteProbe
+)
+
+// WriteProbeKey is the name of the probe object below the prefix.
+const WriteProbeKey = ".s3logger-write-probe"
+
+// bucketCheckTimeout bounds the bucket checks of a lazy start if no upload
+// timeout is set.
+const bucketCheckTimeout = 30 * time.Second
+
+// lazyStartBackoff paces the bucket checks of a lazy start.
+var lazyStartBackoff = RetryPolicy{
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithBucketCheck sets how New verifies the bucket.
+func WithBucketCheck(check BucketCheck) Option {
+	return func(l *S3Logger) error {
+		if check < BucketCheckHead || check > BucketCheckWriteProbe {
+			return fmt.Errorf("unknown bucket check %d", check)
+		}
+		l.bucketCheck = check
+		return nil
+	}
+}
+
+// WithoutBucketCheck is WithBucketCheck(BucketCheckNone).
+func WithoutBucketCheck() Option {
+	return WithBucketCheck(BucketCheckNone)
+}
+
+// WithLazyStart makes New return without waiting for the bucket check. The
+// check is repeated in the background until it succeeds, meanwhile records
+// are buffered and uploads wait. If the bucket is missing or access is
+// denied, uploads fail with ErrBucketNotFound or ErrAccessDenied. Close
+// gives up after one more check.
+func WithLazyStart() Option {
+	return func(l *S3Logger) error {
+		l.lazyStart = true
+		return nil
+	}
+}
+
+// objectDeleter is implemented by S3 clients which can delete the write
+// probe, such as *s3.Client.
+type objectDeleter interface {
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// checkBucket verifies the bucket according to l.bucketCheck. Loggers with
+// a sink have no bucket.
+func (l *S3Logger) checkBucket(ctx context.Context) error {
+	switch {
+	case l.customSink:
+		return nil
+	case l.bucketCheck == BucketCheckNone:
+		return nil
+	case l.bucketCheck == BucketCheckWriteProbe:
+		input := &s3.PutObjectInput{
+			Bucket:               aws.String(l.bucket),
+			Key:                  aws.String(l.prefix + WriteProbeKey),
+			Body:                 bytes.NewReader(nil),
+			ContentLength:        aws.Int64(0),
+			ServerSideEncryption: l.sse,
+		}
+		if l.sseKMSKeyID != "" {
+			input.SSEKMSKeyId = aws.String(l.sseKMSKeyID)
+		}
+		_, err := l.service.PutObject(ctx, input, l.s3Options()...)
+		if err != nil {
+			return l.bucketError(err)
+		}
+		// loggers often may not delete, which does not fail the check
+		if deleter, ok := l.service.(objectDeleter); ok {
+			_, _ = deleter.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: input.Bucket, Key: input.Key}, l.s3Options()...)
+		}
+		return nil
+	default:
+		_, err := l.service.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: aws.String(l.bucket)}, l.s3Options()...)
+		return l.bucketError(err)
+	}
+}
+
+// bucketError classifies an error of the bucket check.
+func (l *S3Logger) bucketError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchBucket":
+			return fmt.Errorf("%w: %s: %w", ErrBucketNotFound, l.bucket, err)
+		case "Forbidden", "AccessDenied":
+			return fmt.Errorf("%w: %s: %w", ErrAccessDenied, l.bucket, err)
+		}
+	}
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		switch statusErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s: %w", ErrBucketNotFound, l.bucket, err)
+		case http.StatusForbidden:
+			return fmt.Errorf("%w: %s: %w", ErrAccessDenied, l.bucket, err)
+		}
+	}
+	return fmt.Errorf("could not check bucket %s: %w", l.bucket, err)
+}
+
+// startLazy checks the bucket in the background until it succeeds, fails
+// for good or the logger is closed.
+func (l *S3Logger) startLazy() {
+	l.ready = make(chan struct{})
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		defer close(l.ready)
+		for retry := 1; ; retry++ {
+			err := l.boundedCheckBucket()
+			if err == nil || errors.Is(err, ErrBucketNotFound) || errors.Is(err, ErrAccessDenied) {
+				l.startErr = err
+				return
+			}
+			timer := time.NewTimer(lazyStartBackoff.backoff(retry))
+			select {
+			case <-l.done:
+				timer.Stop()
+				// one more try for the final uploads of Close
+				l.startErr = l.boundedCheckBucket()
+				return
+			case <-timer.C:
+			}
+		}
+	}()
+}
+
+// boundedCheckBucket is checkBucket bounded by the upload timeout or
+// bucketCheckTimeout.
+func (l *S3Logger) boundedCheckBucket() error {
+	timeout := l.uploadTimeout
+	if timeout <= 0 {
+		timeout = bucketCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return l.checkBucket(ctx)
+}
+
+// waitReady blocks uploads until the bucket check of a lazy start is done.
+func (l *S3Logger) waitReady(ctx context.Context) error {
+	if l.ready == nil {
+		return nil
+	}
+	select {
+	case <-l.ready:
+		return l.startErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
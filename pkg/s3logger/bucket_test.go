@@ -0,0 +1,187 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketCheckErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		headErr error
+		target  error
+	}{
+		{"not found", &types.NotFound{}, ErrBucketNotFound},
+		{"no such bucket", &types.NoSuchBucket{}, ErrBucketNotFound},
+		{"forbidden", &smithy.GenericAPIError{Code: "Forbidden"}, ErrAccessDenied},
+		{"access denied", &smithy.GenericAPIError{Code: "AccessDenied"}, ErrAccessDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New("foundry-curation-test", s3MockClient{headErr: tt.headErr}, WithoutBatchFrequency())
+			assert.ErrorIs(t, err, tt.target)
+			assert.ErrorIs(t, err, tt.headErr)
+			assert.Contains(t, err.Error(), "foundry-curation-test")
+		})
+	}
+
+	network := errors.New("dial tcp: i/o timeout")
+	_, err := New("foundry-curation-test", s3MockClient{headErr: network}, WithoutBatchFrequency())
+	assert.ErrorIs(t, err, network)
+	assert.NotErrorIs(t, err, ErrBucketNotFound)
+	assert.NotErrorIs(t, err, ErrAccessDenied)
+	assert.Equal(t, "could not check bucket foundry-curation-test: dial tcp: i/o timeout", err.Error())
+}
+
+func TestOptionErrorMessage(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithMultipartUpload(1))
+	assert.EqualError(t, err, "could not apply option: part size must be at least 5242880 bytes")
+}
+
+func TestWithoutBucketCheck(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{headErr: &types.NotFound{}}, WithoutBatchFrequency(), WithoutBucketCheck())
+	assert.NoError(t, err)
+
+	_, err = New("foundry-curation-test", s3MockClient{}, WithBucketCheck(BucketCheck(42)))
+	assert.Error(t, err)
+}
+
+// probeS3Client records the deleted keys and the number of options passed.
+type probeS3Client struct {
+	s3MockClient
+	deleted []string
+	options []int
+}
+
+func (c *probeS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	c.options = append(c.options, len(optFns))
+	return c.s3MockClient.PutObject(ctx, params, optFns...)
+}
+
+func (c *probeS3Client) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.deleted = append(c.deleted, *params.Key)
+	c.options = append(c.options, len(optFns))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestWriteProbe(t *testing.T) {
+	client := &probeS3Client{s3MockClient: s3MockClient{debugChan: make(chan interface{}, 1)}}
+	_, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithPrefix("logs/"), WithBucketCheck(BucketCheckWriteProbe),
+		WithServerSideEncryption(types.ServerSideEncryptionAwsKms, "key-id"))
+	require.NoError(t, err)
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "logs/"+WriteProbeKey, *rs.Key)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, rs.ServerSideEncryption)
+	assert.Equal(t, "key-id", *rs.SSEKMSKeyId)
+	assert.Equal(t, []string{"logs/" + WriteProbeKey}, client.deleted)
+	assert.Equal(t, []int{0, 0}, client.options)
+
+	// the SDK retryer is disabled like for uploads
+	client = &probeS3Client{}
+	_, err = New("foundry-curation-test", client, WithoutBatchFrequency(), WithBucketCheck(BucketCheckWriteProbe),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, client.options)
+
+	// clients without DeleteObject leave the probe object
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithBucketCheck(BucketCheckWriteProbe))
+	assert.NoError(t, err)
+
+	denied := s3MockClient{putErr: &smithy.GenericAPIError{Code: "AccessDenied"}}
+	_, err = New("foundry-curation-test", denied, WithoutBatchFrequency(), WithBucketCheck(BucketCheckWriteProbe))
+	assert.ErrorIs(t, err, ErrAccessDenied)
+}
+
+// unreachableS3Client fails HeadBucket until reachable is set.
+type unreachableS3Client struct {
+	s3MockClient
+	reachable atomic.Bool
+	heads     atomic.Int32
+}
+
+func (c *unreachableS3Client) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	c.heads.Add(1)
+	if !c.reachable.Load() {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	return c.s3MockClient.HeadBucket(ctx, params, optFns...)
+}
+
+func TestLazyStart(t *testing.T) {
+	client := &unreachableS3Client{s3MockClient: s3MockClient{debugChan: make(chan interface{}, 1)}}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithLazyStart())
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("buffered while unreachable\n")))
+	synced := make(chan struct{})
+	go func() {
+		l.Sync()
+		close(synced)
+	}()
+	assert.Eventually(t, func() bool { return client.heads.Load() >= 2 }, time.Second, time.Millisecond)
+	assert.Empty(t, client.debugChan)
+
+	client.reachable.Store(true)
+	select {
+	case rs := <-client.debugChan:
+		assert.Equal(t, "buffered while unreachable\n", readBody(t, rs.(*s3.PutObjectInput)))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no upload after the bucket became reachable")
+	}
+	<-synced
+	assert.NoError(t, l.Close(context.Background()))
+}
+
+func TestLazyStartBucketNotFound(t *testing.T) {
+	var deadLetter error
+	l, err := New("foundry-curation-test", s3MockClient{headErr: &types.NotFound{}}, WithoutBatchFrequency(), WithLazyStart(),
+		WithOnUploadError(func(_ string, _ []byte, err error) { deadLetter = err }))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("lost\n")))
+	err = l.Close(context.Background())
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+	assert.ErrorIs(t, deadLetter, ErrBucketNotFound)
+}
+
+// hangingS3Client blocks HeadBucket until ctx is done.
+type hangingS3Client struct {
+	s3MockClient
+}
+
+func (c hangingS3Client) HeadBucket(ctx context.Context, _ *s3.HeadBucketInput, _ ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestLazyStartBoundsChecks(t *testing.T) {
+	l, err := New("foundry-curation-test", hangingS3Client{}, WithoutBatchFrequency(), WithLazyStart(),
+		WithUploadTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("lost\n")))
+	start := time.Now()
+	err = l.Close(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestLazyStartGivesUpOnClose(t *testing.T) {
+	client := &unreachableS3Client{}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithLazyStart())
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("lost\n")))
+	err = l.Close(context.Background())
+	assert.ErrorContains(t, err, "connection refused")
+}
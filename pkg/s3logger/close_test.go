@@ -0,0 +1,83 @@
+package s3logger
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingS3Client struct {
+	s3MockClient
+}
+
+func (c blockingS3Client) PutObject(ctx context.Context, _ *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCloseFlushes(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithBatchFrequency(time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("last words\n")))
+	require.NoError(t, l.Close(context.Background()))
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	reader, err := gzip.NewReader(rs.Body)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "last words\n", string(data))
+
+	assert.ErrorIs(t, l.Write([]byte("too late\n")), ErrClosed)
+	assert.ErrorIs(t, l.Close(context.Background()), ErrClosed)
+}
+
+func TestCloseReturnsUploadError(t *testing.T) {
+	uploadErr := errors.New("access denied")
+	l, err := New("foundry-curation-test", s3MockClient{putErr: uploadErr}, WithoutBatchFrequency(),
+		WithOnUploadError(func(string, []byte, error) {}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("never stored\n")))
+	assert.ErrorIs(t, l.Close(context.Background()), uploadErr)
+}
+
+func TestCloseRespectsDeadline(t *testing.T) {
+	l, err := New("foundry-curation-test", blockingS3Client{}, WithoutBatchFrequency(),
+		WithOnUploadError(func(string, []byte, error) {}))
+	require.NoError(t, err)
+	require.NoError(t, l.Write([]byte("stuck\n")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = l.Close(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestCloseDrainsSpool(t *testing.T) {
+	dir := t.TempDir()
+	client := s3MockClient{debugChan: make(chan interface{}, 10)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("spooled on close\n")))
+	require.NoError(t, l.Close(context.Background()))
+
+	assert.Len(t, client.debugChan, 1)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,136 @@
+package s3logger
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+)
+
+// Limits of PutLogEvents.
+const (
+	cloudWatchLogsMaxEvents     = 10_000
+	cloudWatchLogsMaxBatchBytes = 1_048_576
+	cloudWatchLogsMaxEventBytes = 262_144 - cloudWatchLogsEventOverhead
+	cloudWatchLogsEventOverhead = 26
+)
+
+// CloudWatchLogsClient is the part of the CloudWatch Logs API used by
+// CloudWatchLogsSink.
+type CloudWatchLogsClient interface {
+	PutLogEvents(ctx context.Context, params *cloudwatchlogs.PutLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error)
+	CreateLogStream(ctx context.Context, params *cloudwatchlogs.CreateLogStreamInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error)
+}
+
+// CloudWatchLogsSink sends every record as log event to a log stream, which
+// is created if it does not exist. An event gets the time of its record,
+// read from the TimeKey field of JSON records, and otherwise the time of the
+// last record of the chunk. Records larger than an event are truncated. A
+// retried chunk may duplicate the events of batches that were sent before
+// the failure. Use NoneCodec to avoid compressing the chunks just to
+// decompress them again.
+type CloudWatchLogsSink struct {
+	Client    CloudWatchLogsClient
+	LogGroup  string
+	LogStream string
+	// TimeKey holds an RFC 3339 time or Unix seconds, "time" if empty.
+	TimeKey string
+}
+
+func (s CloudWatchLogsSink) Put(ctx context.Context, o Object) error {
+	records, err := o.Split()
+	if err != nil {
+		return err
+	}
+	ts := o.Last
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var events []types.InputLogEvent
+	size := 0
+	for _, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+		if len(record) > cloudWatchLogsMaxEventBytes {
+			record = record[:cloudWatchLogsMaxEventBytes]
+		}
+		message := strings.ToValidUTF8(string(record), "")
+		if len(events) == cloudWatchLogsMaxEvents || size+len(message)+cloudWatchLogsEventOverhead > cloudWatchLogsMaxBatchBytes {
+			err = s.putLogEvents(ctx, events)
+			if err != nil {
+				return err
+			}
+			events, size = nil, 0
+		}
+		events = append(events, types.InputLogEvent{Message: aws.String(message), Timestamp: aws.Int64(s.recordTime(record, ts).UnixMilli())})
+		size += len(message) + cloudWatchLogsEventOverhead
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	return s.putLogEvents(ctx, events)
+}
+
+// recordTime returns the time of a JSON record, or fallback.
+func (s CloudWatchLogsSink) recordTime(record []byte, fallback time.Time) time.Time {
+	if len(record) == 0 || record[0] != '{' {
+		return fallback
+	}
+	key := s.TimeKey
+	if key == "" {
+		key = "time"
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(record, &fields) != nil {
+		return fallback
+	}
+	raw, ok := fields[key]
+	if !ok {
+		return fallback
+	}
+	var t time.Time
+	if json.Unmarshal(raw, &t) == nil {
+		return t
+	}
+	var seconds float64
+	if json.Unmarshal(raw, &seconds) == nil {
+		return time.UnixMilli(int64(seconds * 1000))
+	}
+	return fallback
+}
+
+// putLogEvents sends one batch, creating the log stream if it is missing.
+// PutLogEvents requires the events of a batch in chronological order.
+func (s CloudWatchLogsSink) putLogEvents(ctx context.Context, events []types.InputLogEvent) error {
+	slices.SortStableFunc(events, func(a, b types.InputLogEvent) int {
+		return cmp.Compare(aws.ToInt64(a.Timestamp), aws.ToInt64(b.Timestamp))
+	})
+	input := &cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(s.LogGroup),
+		LogStreamName: aws.String(s.LogStream),
+		LogEvents:     events,
+	}
+	_, err := s.Client.PutLogEvents(ctx, input)
+	var notFound *types.ResourceNotFoundException
+	if !errors.As(err, &notFound) {
+		return err
+	}
+	_, err = s.Client.CreateLogStream(ctx, &cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(s.LogGroup),
+		LogStreamName: aws.String(s.LogStream),
+	})
+	var exists *types.ResourceAlreadyExistsException
+	if err != nil && !errors.As(err, &exists) {
+		return err
+	}
+	_, err = s.Client.PutLogEvents(ctx, input)
+	return err
+}
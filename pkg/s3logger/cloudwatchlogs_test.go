@@ -0,0 +1,116 @@
+package s3logger
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type cloudWatchLogsMockClient struct {
+	mutex   sync.Mutex
+	streams map[string]bool
+	batches [][]types.InputLogEvent
+}
+
+func (c *cloudWatchLogsMockClient) PutLogEvents(_ context.Context, params *cloudwatchlogs.PutLogEventsInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.streams[aws.ToString(params.LogStreamName)] {
+		return nil, &types.ResourceNotFoundException{Message: aws.String("log stream does not exist")}
+	}
+	c.batches = append(c.batches, params.LogEvents)
+	return &cloudwatchlogs.PutLogEventsOutput{}, nil
+}
+
+func (c *cloudWatchLogsMockClient) CreateLogStream(_ context.Context, params *cloudwatchlogs.CreateLogStreamInput, _ ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.streams[aws.ToString(params.LogStreamName)] = true
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func TestCloudWatchLogsSink(t *testing.T) {
+	client := &cloudWatchLogsMockClient{streams: map[string]bool{}}
+	sink := CloudWatchLogsSink{Client: client, LogGroup: "curation", LogStream: "api"}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithCodec(NoneCodec{}))
+	require.NoError(t, err)
+
+	before := time.Now()
+	require.NoError(t, l.WriteRecord([]byte(`{"msg":"first"}`)))
+	require.NoError(t, l.WriteRecord([]byte(`{"msg":"second"}`)))
+	require.NoError(t, l.Close(context.Background()))
+
+	assert.True(t, client.streams["api"])
+	require.Len(t, client.batches, 1)
+	events := client.batches[0]
+	require.Len(t, events, 2)
+	assert.Equal(t, `{"msg":"first"}`, aws.ToString(events[0].Message))
+	assert.Equal(t, `{"msg":"second"}`, aws.ToString(events[1].Message))
+	assert.GreaterOrEqual(t, aws.ToInt64(events[0].Timestamp), before.UnixMilli())
+}
+
+func TestCloudWatchLogsSinkRecordTime(t *testing.T) {
+	client := &cloudWatchLogsMockClient{streams: map[string]bool{"api": true}}
+	sink := CloudWatchLogsSink{Client: client, LogGroup: "curation", LogStream: "api"}
+	last := time.Date(2024, 3, 1, 10, 0, 5, 0, time.UTC)
+	data := `{"time":"2024-03-01T10:00:02Z","msg":"b"}` + "\n" +
+		`{"time":"2024-03-01T10:00:01.5Z","msg":"a"}` + "\n" +
+		"plain\n" +
+		`{"ts":1709287203.25,"msg":"zap"}` + "\n"
+	err := sink.Put(context.Background(), Object{Data: []byte(data), Codec: NoneCodec{}, Delimiter: []byte("\n"), Last: last})
+	require.NoError(t, err)
+
+	require.Len(t, client.batches, 1)
+	var times []int64
+	var messages []string
+	for _, e := range client.batches[0] {
+		times = append(times, aws.ToInt64(e.Timestamp))
+		messages = append(messages, aws.ToString(e.Message))
+	}
+	assert.Equal(t, []int64{
+		time.Date(2024, 3, 1, 10, 0, 1, 5e8, time.UTC).UnixMilli(),
+		time.Date(2024, 3, 1, 10, 0, 2, 0, time.UTC).UnixMilli(),
+		last.UnixMilli(),
+		last.UnixMilli(),
+	}, times)
+	assert.Equal(t, "plain", messages[2])
+
+	client.batches = nil
+	sink.TimeKey = "ts"
+	err = sink.Put(context.Background(), Object{Data: []byte(`{"ts":1709287203.25,"msg":"zap"}`), Codec: NoneCodec{}, Delimiter: []byte("\n"), Last: last})
+	require.NoError(t, err)
+	require.Len(t, client.batches, 1)
+	assert.Equal(t, int64(1709287203250), aws.ToInt64(client.batches[0][0].Timestamp))
+}
+
+func TestCloudWatchLogsSinkBatches(t *testing.T) {
+	client := &cloudWatchLogsMockClient{streams: map[string]bool{"api": true}}
+	sink := CloudWatchLogsSink{Client: client, LogGroup: "curation", LogStream: "api"}
+
+	large := strings.Repeat("x", 300_000)
+	data := strings.Repeat("small\n", cloudWatchLogsMaxEvents+1) + "\n" + strings.Repeat(large+"\n", 5)
+	err := sink.Put(context.Background(), Object{Data: []byte(data), Codec: NoneCodec{}, Delimiter: []byte("\n")})
+	require.NoError(t, err)
+
+	var events []types.InputLogEvent
+	for _, batch := range client.batches {
+		size := 0
+		for _, e := range batch {
+			size += len(aws.ToString(e.Message)) + cloudWatchLogsEventOverhead
+		}
+		assert.LessOrEqual(t, len(batch), cloudWatchLogsMaxEvents)
+		assert.LessOrEqual(t, size, cloudWatchLogsMaxBatchBytes)
+		events = append(events, batch...)
+	}
+	require.Len(t, events, cloudWatchLogsMaxEvents+6)
+	assert.Len(t, aws.ToString(events[len(events)-1].Message), cloudWatchLogsMaxEventBytes)
+}
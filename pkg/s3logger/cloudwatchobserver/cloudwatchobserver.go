@@ -0,0 +1,114 @@
+// Package cloudwatchobserver reports the work of an s3logger.S3Logger as
+// CloudWatch metrics, e.g. via cloudwatchmetrics.CloudWatchMetricSender.
+package cloudwatchobserver
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+// Dimension is the dimension type of cloudwatchmetrics.CloudWatchMetric.
+type Dimension = struct {
+	Name  string
+	Value string
+}
+
+// Metric has the fields of cloudwatchmetrics.CloudWatchMetric, so it can be
+// converted to it, see SenderFunc.
+type Metric struct {
+	Namespace  string
+	MetricName string
+	Unit       string
+	Dimensions []Dimension
+	Value      float64
+}
+
+// Sender sends the metrics of an Observer.
+type Sender interface {
+	Send(m Metric) error
+}
+
+// SenderFunc adapts a function to a Sender, e.g. to send with a
+// cloudwatchmetrics.CloudWatchMetricSender:
+//
+//	cloudwatchobserver.SenderFunc(func(m cloudwatchobserver.Metric) error {
+//		return sender.Send(cloudwatchmetrics.CloudWatchMetric(m))
+//	})
+type SenderFunc func(m Metric) error
+
+func (f SenderFunc) Send(m Metric) error {
+	return f(m)
+}
+
+// maxErrors limits the send errors kept for the next Err.
+const maxErrors = 100
+
+// Observer sends a metric per upload result, chunk and drop. Create the
+// sender with a batch frequency, otherwise every metric is a synchronous
+// PutMetricData call on the logging path. Send errors are kept for Err.
+type Observer struct {
+	s3logger.NopObserver
+	sender     Sender
+	namespace  string
+	dimensions []Dimension
+
+	errMutex sync.Mutex
+	errs     []error
+}
+
+var _ s3logger.Observer = (*Observer)(nil)
+
+// New returns an Observer sending to namespace. The dimensions, e.g. the
+// service name, are added to every metric.
+func New(sender Sender, namespace string, dimensions ...Dimension) *Observer {
+	return &Observer{sender: sender, namespace: namespace, dimensions: dimensions}
+}
+
+// Err returns and forgets the errors of Send since the last call. Errors
+// beyond 100 are discarded.
+func (o *Observer) Err() error {
+	o.errMutex.Lock()
+	defer o.errMutex.Unlock()
+	err := errors.Join(o.errs...)
+	o.errs = nil
+	return err
+}
+
+func (o *Observer) send(name, unit string, value float64, dimensions ...Dimension) {
+	err := o.sender.Send(Metric{
+		Namespace:  o.namespace,
+		MetricName: name,
+		Unit:       unit,
+		Dimensions: append(append([]Dimension{}, o.dimensions...), dimensions...),
+		Value:      value,
+	})
+	if err == nil {
+		return
+	}
+	o.errMutex.Lock()
+	defer o.errMutex.Unlock()
+	if len(o.errs) < maxErrors {
+		o.errs = append(o.errs, err)
+	}
+}
+
+func (o *Observer) UploadResult(e s3logger.UploadEvent) {
+	operation := Dimension{Name: "Operation", Value: string(e.Operation)}
+	o.send("UploadLatency", "Milliseconds", float64(e.Latency.Microseconds())/1000, operation)
+	if e.Err != nil {
+		o.send("UploadErrors", "Count", 1, operation)
+		return
+	}
+	o.send("UploadedBytes", "Bytes", float64(e.Bytes), operation)
+}
+
+func (o *Observer) ChunkCut(e s3logger.ChunkEvent) {
+	o.send("ChunkRecords", "Count", float64(e.Records))
+	o.send("ChunkBytes", "Bytes", float64(e.Bytes))
+}
+
+func (o *Observer) Dropped(e s3logger.DropEvent) {
+	o.send("DroppedRecords", "Count", float64(e.Records), Dimension{Name: "Reason", Value: string(e.Reason)})
+}
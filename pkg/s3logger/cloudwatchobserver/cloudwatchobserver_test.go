@@ -0,0 +1,67 @@
+package cloudwatchobserver
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+type recordingSender struct {
+	metrics []Metric
+	err     error
+}
+
+func (s *recordingSender) Send(m Metric) error {
+	s.metrics = append(s.metrics, m)
+	return s.err
+}
+
+func TestObserver(t *testing.T) {
+	sender := &recordingSender{}
+	o := New(sender, "curation", Dimension{Name: "Service", Value: "feed"})
+
+	o.UploadAttempt(s3logger.UploadEvent{Operation: s3logger.OperationPutObject})
+	o.UploadResult(s3logger.UploadEvent{Operation: s3logger.OperationPutObject, Bytes: 512, Latency: 1500 * time.Microsecond})
+	o.UploadResult(s3logger.UploadEvent{Operation: s3logger.OperationUploadPart, Err: errors.New("throttled")})
+	o.ChunkCut(s3logger.ChunkEvent{Records: 10, Bytes: 512})
+	o.Dropped(s3logger.DropEvent{Reason: s3logger.DropSampled, Records: 3})
+
+	service := Dimension{Name: "Service", Value: "feed"}
+	put := Dimension{Name: "Operation", Value: "PutObject"}
+	part := Dimension{Name: "Operation", Value: "UploadPart"}
+	metric := func(name, unit string, value float64, dimensions ...Dimension) Metric {
+		return Metric{Namespace: "curation", MetricName: name, Unit: unit, Value: value, Dimensions: dimensions}
+	}
+	assert.Equal(t, []Metric{
+		metric("UploadLatency", "Milliseconds", 1.5, service, put),
+		metric("UploadedBytes", "Bytes", 512, service, put),
+		metric("UploadLatency", "Milliseconds", 0, service, part),
+		metric("UploadErrors", "Count", 1, service, part),
+		metric("ChunkRecords", "Count", 10, service),
+		metric("ChunkBytes", "Bytes", 512, service),
+		metric("DroppedRecords", "Count", 3, service, Dimension{Name: "Reason", Value: "sampled"}),
+	}, sender.metrics)
+}
+
+func TestObserverKeepsSendErrors(t *testing.T) {
+	sendErr := errors.New("throttled")
+	sender := &recordingSender{err: sendErr}
+	o := New(SenderFunc(sender.Send), "curation")
+
+	assert.NoError(t, o.Err())
+	o.ChunkCut(s3logger.ChunkEvent{Records: 10, Bytes: 512})
+	err := o.Err()
+	assert.ErrorIs(t, err, sendErr)
+	assert.Len(t, err.(interface{ Unwrap() []error }).Unwrap(), 2)
+	assert.NoError(t, o.Err())
+
+	for i := 0; i < maxErrors; i++ {
+		o.Dropped(s3logger.DropEvent{Reason: s3logger.DropSampled, Records: 1})
+	}
+	o.Dropped(s3logger.DropEvent{Reason: s3logger.DropSampled, Records: 1})
+	assert.Len(t, o.Err().(interface{ Unwrap() []error }).Unwrap(), maxErrors)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger/reader"
+)
+
+// Client is the part of the S3 API used by s3logs.
+type Client interface {
+	s3logger.S3Client
+	reader.Client
+	DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+const usage = `usage: s3logs <command> [flags]
+
+commands:
+  grep     print the records of a time range matching all -where filters
+  cat      print the records of a time range or of the given objects
+  compact  merge the objects uploaded in an hour into one object and delete
+           the manifests listing them
+
+run s3logs <command> -h for the flags of a command`
+
+// layouts maps the -layout flag to the key layouts of reader and s3logger.
+var layouts = map[string]struct {
+	reader  reader.Layout
+	builder s3logger.KeyBuilder
+}{
+	"default": {reader.DefaultLayout, s3logger.DefaultKeyLayout},
+	"hive":    {reader.HiveLayout, s3logger.HiveKeyLayout},
+	"flat":    {reader.FlatLayout, s3logger.FlatKeyLayout},
+}
+
+func run(ctx context.Context, args []string, client Client, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "grep":
+		return grep(ctx, args[1:], client, stdout)
+	case "cat":
+		return cat(ctx, args[1:], client, stdout)
+	case "compact":
+		return compact(ctx, args[1:], client, stdout)
+	default:
+		return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+}
+
+// options are the flags shared by all commands.
+type options struct {
+	bucket    string
+	prefix    string
+	layout    string
+	location  string
+	timeField string
+}
+
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.bucket, "bucket", "", "bucket of the logs (required)")
+	fs.StringVar(&o.prefix, "prefix", "", "key prefix the logger was created with")
+	fs.StringVar(&o.layout, "layout", "default", "key layout: default, hive or flat")
+	fs.StringVar(&o.location, "location", "Local", "time zone of the keys")
+	fs.StringVar(&o.timeField, "time-field", "time", "field holding the record timestamp")
+}
+
+func (o *options) reader(client Client, filters ...reader.Filter) (*reader.Reader, error) {
+	if o.bucket == "" {
+		return nil, errors.New("-bucket is required")
+	}
+	layout, ok := layouts[o.layout]
+	if !ok {
+		return nil, fmt.Errorf("unknown layout %q", o.layout)
+	}
+	loc, err := time.LoadLocation(o.location)
+	if err != nil {
+		return nil, err
+	}
+	return reader.New(o.bucket, client,
+		reader.WithPrefix(o.prefix),
+		reader.WithLayout(layout.reader),
+		reader.WithLocation(loc),
+		reader.WithTimeField(o.timeField),
+		reader.WithFilters(filters...),
+	)
+}
+
+// timeRange are the -from and -to flags.
+type timeRange struct {
+	from string
+	to   string
+}
+
+func (t *timeRange) register(fs *flag.FlagSet) {
+	fs.StringVar(&t.from, "from", "1h", "start of the range, RFC 3339 or a duration before now")
+	fs.StringVar(&t.to, "to", "0s", "end of the range, RFC 3339 or a duration before now")
+}
+
+func (t *timeRange) parse(now time.Time) (time.Time, time.Time, error) {
+	from, err := parseTime(t.from, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -from: %w", err)
+	}
+	to, err := parseTime(t.to, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid -to: %w", err)
+	}
+	return from, to, nil
+}
+
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// whereFlags collects -where filters: field=value, field!=value or field~regexp.
+type whereFlags []reader.Filter
+
+func (w *whereFlags) String() string {
+	return ""
+}
+
+func (w *whereFlags) Set(s string) error {
+	if field, value, ok := strings.Cut(s, "!="); ok {
+		*w = append(*w, reader.Not(reader.Equals(field, value)))
+		return nil
+	}
+	if field, value, ok := strings.Cut(s, "="); ok {
+		*w = append(*w, reader.Equals(field, value))
+		return nil
+	}
+	if field, expr, ok := strings.Cut(s, "~"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return err
+		}
+		*w = append(*w, reader.Matches(field, re))
+		return nil
+	}
+	return fmt.Errorf("invalid filter %q, expected field=value, field!=value or field~regexp", s)
+}
+
+func grep(ctx context.Context, args []string, client Client, stdout io.Writer) error {
+	fs := flag.NewFlagSet("grep", flag.ContinueOnError)
+	var opts options
+	var tr timeRange
+	var where whereFlags
+	opts.register(fs)
+	tr.register(fs)
+	fs.Var(&where, "where", "filter field=value, field!=value or field~regexp, may be repeated")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	from, to, err := tr.parse(time.Now())
+	if err != nil {
+		return err
+	}
+	r, err := opts.reader(client, where...)
+	if err != nil {
+		return err
+	}
+	return printRecords(stdout, func(fn func(reader.Record) error) error {
+		return r.Read(ctx, from, to, fn)
+	})
+}
+
+func cat(ctx context.Context, args []string, client Client, stdout io.Writer) error {
+	fs := flag.NewFlagSet("cat", flag.ContinueOnError)
+	var opts options
+	var tr timeRange
+	opts.register(fs)
+	tr.register(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	r, err := opts.reader(client)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return printRecords(stdout, func(fn func(reader.Record) error) error {
+			return r.ReadKeys(ctx, fs.Args(), fn)
+		})
+	}
+	from, to, err := tr.parse(time.Now())
+	if err != nil {
+		return err
+	}
+	return printRecords(stdout, func(fn func(reader.Record) error) error {
+		return r.Read(ctx, from, to, fn)
+	})
+}
+
+// printRecords writes the records passed to fn by read line by line.
+func printRecords(stdout io.Writer, read func(fn func(reader.Record) error) error) error {
+	w := bufio.NewWriter(stdout)
+	err := read(func(record reader.Record) error {
+		_, err := w.Write(append(record.Data, '\n'))
+		return err
+	})
+	return errors.Join(err, w.Flush())
+}
+
+func compact(ctx context.Context, args []string, client Client, stdout io.Writer) error {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	var opts options
+	var hour string
+	var dryRun bool
+	opts.register(fs)
+	fs.StringVar(&hour, "hour", "", "hour to compact, RFC 3339 or a duration before now (required)")
+	fs.BoolVar(&dryRun, "dry-run", false, "only print the objects that would be merged and the manifests that would be deleted")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if hour == "" {
+		return errors.New("-hour is required")
+	}
+	t, err := parseTime(hour, time.Now())
+	if err != nil {
+		return fmt.Errorf("invalid -hour: %w", err)
+	}
+	r, err := opts.reader(client)
+	if err != nil {
+		return err
+	}
+	keys, err := r.List(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	// the location was validated by opts.reader
+	loc, _ := time.LoadLocation(opts.location)
+	t = t.In(loc)
+	start := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	target := layouts[opts.layout].builder(s3logger.KeyInfo{
+		Prefix:    opts.prefix,
+		FileID:    "compacted",
+		Time:      start,
+		Extension: s3logger.GzipCodec{}.Extension(),
+	})
+	// a previously compacted object is merged again with late uploads,
+	// Parquet objects are left alone rather than rewritten as NDJSON
+	var sources []string
+	for _, key := range keys {
+		codec, ok := s3logger.CodecForKey(key)
+		if _, parquet := codec.(s3logger.ParquetCodec); ok && !parquet {
+			sources = append(sources, key)
+		}
+	}
+	if len(sources) < 2 {
+		_, err = fmt.Fprintf(stdout, "nothing to compact in %s\n", start.Format(time.RFC3339))
+		return err
+	}
+	manifests, err := manifestsListing(ctx, client, opts.bucket, keys, sources)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		for _, key := range append(sources, manifests...) {
+			_, err = fmt.Fprintln(stdout, key)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// the merged object is streamed by an S3Logger to the target key, the
+	// sources are read one after the other
+	l, err := s3logger.New(opts.bucket, client,
+		s3logger.WithoutBatchFrequency(),
+		s3logger.WithMaxFileSize(0),
+		s3logger.WithMultipartUpload(s3logger.MinPartSize),
+		s3logger.WithKeyBuilder(func(s3logger.KeyInfo) string { return target }),
+	)
+	if err != nil {
+		return err
+	}
+	err = r.ReadKeys(ctx, sources, func(record reader.Record) error {
+		return l.WriteRecord(record.Data)
+	})
+	err = errors.Join(err, l.Close(ctx))
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", target, err)
+	}
+
+	// the manifests go first, so they never list deleted objects
+	err = deleteObjects(ctx, client, opts.bucket, manifests, target)
+	if err != nil {
+		return err
+	}
+	err = deleteObjects(ctx, client, opts.bucket, sources, target)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "compacted %d objects into %s\n", len(sources), target)
+	return err
+}
+
+// manifestsListing returns the manifests among keys which list one of the
+// sources. They no longer describe the hour once the sources are compacted.
+func manifestsListing(ctx context.Context, client Client, bucket string, keys, sources []string) ([]string, error) {
+	var manifests []string
+	for _, key := range keys {
+		if !strings.HasSuffix(key, s3logger.ManifestExtension) {
+			continue
+		}
+		out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("could not get manifest %s: %w", key, err)
+		}
+		var m s3logger.Manifest
+		err = json.NewDecoder(out.Body).Decode(&m)
+		out.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not decode manifest %s: %w", key, err)
+		}
+		if slices.ContainsFunc(m.Chunks, func(c s3logger.ManifestChunk) bool { return slices.Contains(sources, c.Key) }) {
+			manifests = append(manifests, key)
+		}
+	}
+	return manifests, nil
+}
+
+// deleteObjects deletes keys except keep in batches of 1000.
+func deleteObjects(ctx context.Context, client Client, bucket string, keys []string, keep string) error {
+	var objects []types.ObjectIdentifier
+	for _, key := range keys {
+		if key != keep {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+	}
+	for len(objects) > 0 {
+		n := min(len(objects), 1000)
+		out, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects[:n], Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return fmt.Errorf("could not delete compacted objects: %w", err)
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("could not delete %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+		objects = objects[n:]
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+// memoryS3Client stores objects in memory.
+type memoryS3Client struct {
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func newMemoryS3Client() *memoryS3Client {
+	return &memoryS3Client{objects: map[string][]byte{}}
+}
+
+func (c *memoryS3Client) HeadBucket(context.Context, *s3.HeadBucketInput, ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (c *memoryS3Client) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.objects[aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *memoryS3Client) CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) DeleteObject(_ context.Context, params *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.objects, aws.ToString(params.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (c *memoryS3Client) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range c.keys() {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+		}
+	}
+	return out, nil
+}
+
+func (c *memoryS3Client) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (c *memoryS3Client) DeleteObjects(_ context.Context, params *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, obj := range params.Delete.Objects {
+		delete(c.objects, aws.ToString(obj.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+func (c *memoryS3Client) keys() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var keys []string
+	for key := range c.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// putRecords stores the records gzipped under key.
+func putRecords(t *testing.T, client Client, key string, records ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := s3logger.GzipCodec{}.NewWriter(&buf)
+	require.NoError(t, err)
+	for _, record := range records {
+		_, err = w.Write([]byte(record + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	_, err = client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("logs"),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	require.NoError(t, err)
+}
+
+// putTestLogs stores two objects of 2024-03-01 10:00 UTC.
+func putTestLogs(t *testing.T, client Client) {
+	t.Helper()
+	putRecords(t, client, "app/2024/03/01/10/a-1.gz",
+		`{"time":"2024-03-01T10:00:01Z","level":"INFO","msg":"a1"}`,
+		`{"time":"2024-03-01T10:00:03Z","level":"ERROR","msg":"a3"}`)
+	putRecords(t, client, "app/2024/03/01/10/b-1.gz",
+		`{"time":"2024-03-01T10:00:02Z","level":"ERROR","msg":"b2"}`)
+}
+
+func runCommand(t *testing.T, client Client, args ...string) string {
+	t.Helper()
+	var stdout bytes.Buffer
+	require.NoError(t, run(context.Background(), args, client, &stdout))
+	return stdout.String()
+}
+
+var rangeFlags = []string{"-bucket", "logs", "-prefix", "app/", "-location", "UTC",
+	"-from", "2024-03-01T10:00:00Z", "-to", "2024-03-01T11:00:00Z"}
+
+func TestGrep(t *testing.T) {
+	client := newMemoryS3Client()
+	putTestLogs(t, client)
+
+	out := runCommand(t, client, append([]string{"grep", "-where", "level=ERROR"}, rangeFlags...)...)
+	assert.Equal(t, `{"time":"2024-03-01T10:00:02Z","level":"ERROR","msg":"b2"}
+{"time":"2024-03-01T10:00:03Z","level":"ERROR","msg":"a3"}
+`, out)
+
+	out = runCommand(t, client, append([]string{"grep", "-where", "level!=ERROR", "-where", "msg~^a"}, rangeFlags...)...)
+	assert.Equal(t, `{"time":"2024-03-01T10:00:01Z","level":"INFO","msg":"a1"}`+"\n", out)
+}
+
+func TestCat(t *testing.T) {
+	client := newMemoryS3Client()
+	putTestLogs(t, client)
+
+	out := runCommand(t, client, append([]string{"cat"}, rangeFlags...)...)
+	assert.Equal(t, 3, strings.Count(out, "\n"))
+
+	out = runCommand(t, client, "cat", "-bucket", "logs", "app/2024/03/01/10/b-1.gz")
+	assert.Equal(t, `{"time":"2024-03-01T10:00:02Z","level":"ERROR","msg":"b2"}`+"\n", out)
+}
+
+func TestCompact(t *testing.T) {
+	client := newMemoryS3Client()
+	putTestLogs(t, client)
+	hourFlags := []string{"-bucket", "logs", "-prefix", "app/", "-location", "UTC", "-hour", "2024-03-01T10:30:00Z"}
+
+	out := runCommand(t, client, append([]string{"compact", "-dry-run"}, hourFlags...)...)
+	assert.Equal(t, "app/2024/03/01/10/a-1.gz\napp/2024/03/01/10/b-1.gz\n", out)
+	assert.Len(t, client.keys(), 2)
+
+	target := "app/2024/03/01/10/compacted-1709287200000000.gz"
+	out = runCommand(t, client, append([]string{"compact"}, hourFlags...)...)
+	assert.Equal(t, "compacted 2 objects into "+target+"\n", out)
+	assert.Equal(t, []string{target}, client.keys())
+
+	out = runCommand(t, client, "cat", "-bucket", "logs", target)
+	assert.Equal(t, `{"time":"2024-03-01T10:00:01Z","level":"INFO","msg":"a1"}
+{"time":"2024-03-01T10:00:02Z","level":"ERROR","msg":"b2"}
+{"time":"2024-03-01T10:00:03Z","level":"ERROR","msg":"a3"}
+`, out)
+
+	out = runCommand(t, client, append([]string{"compact"}, hourFlags...)...)
+	assert.Equal(t, "nothing to compact in 2024-03-01T10:00:00Z\n", out)
+
+	// late uploads are merged into the compacted object
+	putRecords(t, client, "app/2024/03/01/10/c-1.gz", `{"time":"2024-03-01T10:00:00Z","level":"INFO","msg":"c0"}`)
+	out = runCommand(t, client, append([]string{"compact"}, hourFlags...)...)
+	assert.Equal(t, "compacted 2 objects into "+target+"\n", out)
+	assert.Equal(t, []string{target}, client.keys())
+	out = runCommand(t, client, "cat", "-bucket", "logs", target)
+	assert.Equal(t, 4, strings.Count(out, "\n"))
+	assert.True(t, strings.HasPrefix(out, `{"time":"2024-03-01T10:00:00Z","level":"INFO","msg":"c0"}`), out)
+}
+
+func TestCompactDeletesManifests(t *testing.T) {
+	client := newMemoryS3Client()
+	putTestLogs(t, client)
+	putManifest := func(key string, chunks ...string) {
+		m := s3logger.Manifest{Complete: true}
+		for _, chunk := range chunks {
+			m.Chunks = append(m.Chunks, s3logger.ManifestChunk{Key: chunk})
+		}
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		_, err = client.PutObject(context.Background(), &s3.PutObjectInput{Key: aws.String(key), Body: bytes.NewReader(data)})
+		require.NoError(t, err)
+	}
+	listing := "app/2024/03/01/10/a-1709287200000000.manifest.json"
+	other := "app/2024/03/01/10/p-1709287200000000.manifest.json"
+	putManifest(listing, "app/2024/03/01/10/a-1.gz")
+	putManifest(other, "app/2024/03/01/10/p-1.parquet")
+	hourFlags := []string{"-bucket", "logs", "-prefix", "app/", "-location", "UTC", "-hour", "2024-03-01T10:30:00Z"}
+
+	out := runCommand(t, client, append([]string{"compact", "-dry-run"}, hourFlags...)...)
+	assert.Equal(t, "app/2024/03/01/10/a-1.gz\napp/2024/03/01/10/b-1.gz\n"+listing+"\n", out)
+
+	target := "app/2024/03/01/10/compacted-1709287200000000.gz"
+	out = runCommand(t, client, append([]string{"compact"}, hourFlags...)...)
+	assert.Equal(t, "compacted 2 objects into "+target+"\n", out)
+	assert.Equal(t, []string{target, other}, client.keys())
+}
+
+func TestCompactKeepsParquet(t *testing.T) {
+	client := newMemoryS3Client()
+	putTestLogs(t, client)
+	var buf bytes.Buffer
+	w, err := s3logger.ParquetCodec{}.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"time":"2024-03-01T10:00:04Z","level":"INFO","msg":"p4"}` + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	parquetKey := "app/2024/03/01/10/p-1.parquet"
+	_, err = client.PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket: aws.String("logs"),
+		Key:    aws.String(parquetKey),
+		Body:   bytes.NewReader(buf.Bytes()),
+	})
+	require.NoError(t, err)
+
+	target := "app/2024/03/01/10/compacted-1709287200000000.gz"
+	out := runCommand(t, client, "compact", "-bucket", "logs", "-prefix", "app/", "-location", "UTC", "-hour", "2024-03-01T10:30:00Z")
+	assert.Equal(t, "compacted 2 objects into "+target+"\n", out)
+	assert.ElementsMatch(t, []string{target, parquetKey}, client.keys())
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	assert.Equal(t, buf.Bytes(), client.objects[parquetKey])
+}
+
+func TestInvalidArguments(t *testing.T) {
+	client := newMemoryS3Client()
+	tests := [][]string{
+		nil,
+		{"unknown"},
+		{"grep"},
+		{"grep", "-bucket", "logs", "-where", "level"},
+		{"grep", "-bucket", "logs", "-from", "yesterday"},
+		{"grep", "-bucket", "logs", "-layout", "daily"},
+		{"cat", "-bucket", "logs", "-location", "Mars/Olympus"},
+		{"compact", "-bucket", "logs"},
+	}
+	for _, args := range tests {
+		err := run(context.Background(), args, client, io.Discard)
+		assert.Error(t, err, args)
+	}
+}
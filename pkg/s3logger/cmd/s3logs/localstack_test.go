@@ -0,0 +1,37 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/testcontainers"
+)
+
+func TestLocalStack(t *testing.T) {
+	ls := testcontainers.StartLocalStack(t, []testcontainers.Service{testcontainers.ServiceS3})
+	client := ls.GetS3Client()
+	_, err := client.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("logs")})
+	require.NoError(t, err)
+	putTestLogs(t, client)
+
+	out := runCommand(t, client, append([]string{"grep", "-where", "level=ERROR"}, rangeFlags...)...)
+	assert.Equal(t, 2, strings.Count(out, "\n"))
+
+	out = runCommand(t, client, "compact", "-bucket", "logs", "-prefix", "app/", "-location", "UTC", "-hour", "2024-03-01T10:00:00Z")
+	assert.Equal(t, "compacted 2 objects into app/2024/03/01/10/compacted-1709287200000000.gz\n", out)
+
+	out = runCommand(t, client, append([]string{"cat"}, rangeFlags...)...)
+	assert.Equal(t, `{"time":"2024-03-01T10:00:01Z","level":"INFO","msg":"a1"}
+{"time":"2024-03-01T10:00:02Z","level":"ERROR","msg":"b2"}
+{"time":"2024-03-01T10:00:03Z","level":"ERROR","msg":"a3"}
+`, out)
+}
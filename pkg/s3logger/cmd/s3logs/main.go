@@ -0,0 +1,35 @@
+// Command s3logs reads the logs written by s3logger.S3Logger.
+//
+//	s3logs grep -bucket logs -prefix app/ -from 2h -where level=ERROR
+//	s3logs cat -bucket logs -prefix app/ -from 2024-03-01T10:00:00Z -to 2024-03-01T11:00:00Z
+//	s3logs cat -bucket logs app/2024/03/01/10/fileID-1709287200000000.gz
+//	s3logs compact -bucket logs -prefix app/ -hour 2024-03-01T10:00:00Z
+//
+// AWS credentials and region are taken from the environment.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	err = run(ctx, os.Args[1:], s3.NewFromConfig(cfg), os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
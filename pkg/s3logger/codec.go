@@ -0,0 +1,124 @@
+package s3logger
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec compresses the chunks of an S3Logger.
+type Codec interface {
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// Extension is appended to the object key, including the leading dot.
+	Extension() string
+	ContentEncoding() string
+	ContentType() string
+}
+
+const ndjsonContentType = "application/x-ndjson"
+
+// GzipCodec is the default codec. A zero Level uses gzip.DefaultCompression.
+type GzipCodec struct {
+	Level int
+}
+
+func (c GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.Level == 0 {
+		return gzip.NewWriter(w), nil
+	}
+	return gzip.NewWriterLevel(w, c.Level)
+}
+
+func (c GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (c GzipCodec) Extension() string       { return ".gz" }
+func (c GzipCodec) ContentEncoding() string { return "gzip" }
+func (c GzipCodec) ContentType() string     { return ndjsonContentType }
+
+// ZstdCodec compresses with zstd. A zero Level uses zstd.SpeedDefault.
+type ZstdCodec struct {
+	Level zstd.EncoderLevel
+}
+
+func (c ZstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	level := c.Level
+	if level == 0 {
+		level = zstd.SpeedDefault
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+}
+
+func (c ZstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+func (c ZstdCodec) Extension() string       { return ".zst" }
+func (c ZstdCodec) ContentEncoding() string { return "zstd" }
+func (c ZstdCodec) ContentType() string     { return ndjsonContentType }
+
+// SnappyCodec compresses with the snappy framing format.
+type SnappyCodec struct{}
+
+func (c SnappyCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return snappy.NewBufferedWriter(w), nil
+}
+
+func (c SnappyCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(snappy.NewReader(r)), nil
+}
+
+func (c SnappyCodec) Extension() string       { return ".sz" }
+func (c SnappyCodec) ContentEncoding() string { return "" }
+func (c SnappyCodec) ContentType() string     { return "application/x-snappy-framed" }
+
+// NoneCodec writes uncompressed chunks.
+type NoneCodec struct{}
+
+func (c NoneCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return nopWriteCloser{w}, nil
+}
+
+func (c NoneCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(r), nil
+}
+
+func (c NoneCodec) Extension() string       { return ".ndjson" }
+func (c NoneCodec) ContentEncoding() string { return "" }
+func (c NoneCodec) ContentType() string     { return ndjsonContentType }
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// CodecForKey returns the built-in codec of an object key by its extension.
+func CodecForKey(key string) (Codec, bool) {
+	for _, c := range []Codec{GzipCodec{}, ZstdCodec{}, SnappyCodec{}, NoneCodec{}, ParquetCodec{}} {
+		if strings.HasSuffix(key, c.Extension()) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+func WithCodec(c Codec) Option {
+	return func(l *S3Logger) error {
+		if c == nil {
+			return errors.New("codec must not be nil")
+		}
+		l.codec = c
+		return nil
+	}
+}
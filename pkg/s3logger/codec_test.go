@@ -0,0 +1,60 @@
+package s3logger
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		codec           Codec
+		extension       string
+		contentEncoding *string
+		contentType     string
+	}{
+		{GzipCodec{}, ".gz", strPtr("gzip"), "application/x-ndjson"},
+		{ZstdCodec{}, ".zst", strPtr("zstd"), "application/x-ndjson"},
+		{SnappyCodec{}, ".sz", nil, "application/x-snappy-framed"},
+		{NoneCodec{}, ".ndjson", nil, "application/x-ndjson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.extension, func(t *testing.T) {
+			client := s3MockClient{debugChan: make(chan interface{}, 1)}
+			l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(tt.codec))
+			require.NoError(t, err)
+
+			input := strings.Repeat(`{"msg":"compress me"}`+"\n", 1_000)
+			require.NoError(t, l.Write([]byte(input)))
+			l.Sync()
+
+			rs := (<-client.debugChan).(*s3.PutObjectInput)
+			assert.True(t, strings.HasSuffix(*rs.Key, tt.extension), *rs.Key)
+			assert.Equal(t, tt.contentEncoding, rs.ContentEncoding)
+			assert.Equal(t, tt.contentType, *rs.ContentType)
+
+			reader, err := tt.codec.NewReader(rs.Body)
+			require.NoError(t, err)
+			defer reader.Close()
+			data, err := io.ReadAll(reader)
+			require.NoError(t, err)
+			assert.Equal(t, input, string(data))
+		})
+	}
+}
+
+func TestInvalidCodec(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithCodec(GzipCodec{Level: 42}))
+	assert.Error(t, err)
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithCodec(nil))
+	assert.Error(t, err)
+}
+
+func strPtr(s string) *string {
+	return &s
+}
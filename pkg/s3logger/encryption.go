@@ -0,0 +1,139 @@
+package s3logger
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Metadata keys set on client-side encrypted objects.
+const (
+	MetadataEncryptionKey       = "encryption-key"
+	MetadataEncryptionAlgorithm = "encryption-algorithm"
+)
+
+// EncryptedExtension is appended to the codec extension of client-side
+// encrypted objects.
+const EncryptedExtension = ".enc"
+
+const (
+	encryptionAlgorithm = "AES256-GCM"
+	dataKeySize         = 32
+)
+
+// KeyWrapper wraps the per-object data keys of client-side encryption, e.g.
+// with a key encryption key or a KMS master key.
+type KeyWrapper interface {
+	WrapKey(key []byte) ([]byte, error)
+	UnwrapKey(wrapped []byte) ([]byte, error)
+}
+
+// WithClientSideEncryption encrypts every object with a random AES-256-GCM data
+// key before the upload. The data key is wrapped with w and stored base64
+// encoded in the object metadata. Use DecryptEnvelope to read such objects.
+func WithClientSideEncryption(w KeyWrapper) Option {
+	return func(l *S3Logger) error {
+		if w == nil {
+			return errors.New("key wrapper must not be nil")
+		}
+		l.keyWrapper = w
+		return nil
+	}
+}
+
+type aesKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewAESKeyWrapper returns a KeyWrapper encrypting data keys with AES-GCM
+// under the given 16, 24 or 32 byte key encryption key.
+func NewAESKeyWrapper(kek []byte) (KeyWrapper, error) {
+	aead, err := newGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	return &aesKeyWrapper{aead: aead}, nil
+}
+
+func (w *aesKeyWrapper) WrapKey(key []byte) ([]byte, error) {
+	return seal(w.aead, key)
+}
+
+func (w *aesKeyWrapper) UnwrapKey(wrapped []byte) ([]byte, error) {
+	return open(w.aead, wrapped)
+}
+
+// encryptEnvelope encrypts data with a fresh data key and records the wrapped
+// key in metadata.
+func encryptEnvelope(w KeyWrapper, metadata map[string]string, data []byte) ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := w.WrapKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not wrap data key: %w", err)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(aead, data)
+	if err != nil {
+		return nil, err
+	}
+	metadata[MetadataEncryptionKey] = base64.StdEncoding.EncodeToString(wrapped)
+	metadata[MetadataEncryptionAlgorithm] = encryptionAlgorithm
+	return ciphertext, nil
+}
+
+// DecryptEnvelope decrypts an object written with client-side encryption using
+// the object's metadata.
+func DecryptEnvelope(w KeyWrapper, metadata map[string]string, ciphertext []byte) ([]byte, error) {
+	if alg := metadata[MetadataEncryptionAlgorithm]; alg != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported encryption algorithm %q", alg)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(metadata[MetadataEncryptionKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped data key: %w", err)
+	}
+	key, err := w.UnwrapKey(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap data key: %w", err)
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, ciphertext)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal returns nonce and ciphertext of plaintext.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,58 @@
+package s3logger
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientSideEncryption(t *testing.T) {
+	w, err := NewAESKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithClientSideEncryption(w))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("secret record\n")))
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.True(t, strings.HasSuffix(*rs.Key, ".gz.enc"), *rs.Key)
+	assert.Equal(t, "application/octet-stream", *rs.ContentType)
+	assert.Nil(t, rs.ContentEncoding)
+	assert.Equal(t, "AES256-GCM", rs.Metadata[MetadataEncryptionAlgorithm])
+	assert.Equal(t, "1", rs.Metadata[MetadataRecordCount])
+
+	ciphertext, err := io.ReadAll(rs.Body)
+	require.NoError(t, err)
+	assert.NotContains(t, string(ciphertext), "secret")
+
+	plaintext, err := DecryptEnvelope(w, rs.Metadata, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, "secret record\n", readBody(t, &s3.PutObjectInput{Body: bytes.NewReader(plaintext)}))
+
+	other, err := NewAESKeyWrapper(bytes.Repeat([]byte{8}, 32))
+	require.NoError(t, err)
+	_, err = DecryptEnvelope(other, rs.Metadata, ciphertext)
+	assert.Error(t, err)
+}
+
+func TestClientSideEncryptionOptions(t *testing.T) {
+	_, err := NewAESKeyWrapper([]byte("short"))
+	assert.Error(t, err)
+
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithClientSideEncryption(nil))
+	assert.Error(t, err)
+
+	w, err := NewAESKeyWrapper(bytes.Repeat([]byte{7}, 16))
+	require.NoError(t, err)
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(),
+		WithClientSideEncryption(w), WithMultipartUpload(MinPartSize))
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package s3logger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/firehose/types"
+)
+
+// Limits of PutRecordBatch.
+const (
+	firehoseMaxRecords     = 500
+	firehoseMaxBatchBytes  = 4 << 20
+	firehoseMaxRecordBytes = 1000 << 10
+)
+
+// FirehoseClient is the part of the Kinesis Data Firehose API used by
+// FirehoseSink.
+type FirehoseClient interface {
+	PutRecordBatch(ctx context.Context, params *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error)
+}
+
+// FirehoseSink sends every record including its delimiter to a delivery
+// stream. Chunks with records larger than a Firehose record are rejected.
+// A retried chunk may duplicate the records that were accepted before the
+// failure. Use NoneCodec to avoid compressing the chunks just to decompress
+// them again.
+type FirehoseSink struct {
+	Client         FirehoseClient
+	DeliveryStream string
+}
+
+func (s FirehoseSink) Put(ctx context.Context, o Object) error {
+	records, err := o.Split()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if size := len(record) + len(o.Delimiter); size > firehoseMaxRecordBytes {
+			return fmt.Errorf("record of %d bytes exceeds the firehose limit of %d bytes", size, firehoseMaxRecordBytes)
+		}
+	}
+	var batch []types.Record
+	size := 0
+	for _, record := range records {
+		data := make([]byte, 0, len(record)+len(o.Delimiter))
+		data = append(append(data, record...), o.Delimiter...)
+		if len(batch) == firehoseMaxRecords || size+len(data) > firehoseMaxBatchBytes {
+			err = s.putRecordBatch(ctx, batch)
+			if err != nil {
+				return err
+			}
+			batch, size = nil, 0
+		}
+		batch = append(batch, types.Record{Data: data})
+		size += len(data)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	return s.putRecordBatch(ctx, batch)
+}
+
+func (s FirehoseSink) putRecordBatch(ctx context.Context, batch []types.Record) error {
+	out, err := s.Client.PutRecordBatch(ctx, &firehose.PutRecordBatchInput{
+		DeliveryStreamName: aws.String(s.DeliveryStream),
+		Records:            batch,
+	})
+	if err != nil {
+		return err
+	}
+	if failed := aws.ToInt32(out.FailedPutCount); failed > 0 {
+		for _, r := range out.RequestResponses {
+			if r.ErrorCode != nil {
+				return fmt.Errorf("%d of %d records were rejected by firehose: %s: %s", failed, len(batch), aws.ToString(r.ErrorCode), aws.ToString(r.ErrorMessage))
+			}
+		}
+		return fmt.Errorf("%d of %d records were rejected by firehose", failed, len(batch))
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package s3logger
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/firehose/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type firehoseMockClient struct {
+	batches [][]types.Record
+	failed  int32
+}
+
+func (c *firehoseMockClient) PutRecordBatch(_ context.Context, params *firehose.PutRecordBatchInput, _ ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+	c.batches = append(c.batches, params.Records)
+	out := &firehose.PutRecordBatchOutput{FailedPutCount: aws.Int32(c.failed)}
+	for range params.Records {
+		out.RequestResponses = append(out.RequestResponses, types.PutRecordBatchResponseEntry{RecordId: aws.String("id")})
+	}
+	if c.failed > 0 {
+		out.RequestResponses[0] = types.PutRecordBatchResponseEntry{ErrorCode: aws.String("ServiceUnavailableException"), ErrorMessage: aws.String("slow down")}
+	}
+	return out, nil
+}
+
+func TestFirehoseSink(t *testing.T) {
+	client := &firehoseMockClient{}
+	l, err := NewWithSink(FirehoseSink{Client: client, DeliveryStream: "logs"}, WithoutBatchFrequency())
+	require.NoError(t, err)
+
+	for i := 0; i < firehoseMaxRecords+1; i++ {
+		require.NoError(t, l.WriteRecord([]byte(`{"msg":"hello"}`)))
+	}
+	require.NoError(t, l.Close(context.Background()))
+
+	require.Len(t, client.batches, 2)
+	assert.Len(t, client.batches[0], firehoseMaxRecords)
+	assert.Len(t, client.batches[1], 1)
+	assert.Equal(t, "{\"msg\":\"hello\"}\n", string(client.batches[1][0].Data))
+}
+
+func TestFirehoseSinkErrors(t *testing.T) {
+	client := &firehoseMockClient{failed: 1}
+	sink := FirehoseSink{Client: client, DeliveryStream: "logs"}
+	err := sink.Put(context.Background(), Object{Data: []byte("a\nb\n"), Codec: NoneCodec{}, Delimiter: []byte("\n")})
+	assert.ErrorContains(t, err, "1 of 2 records were rejected by firehose: ServiceUnavailableException: slow down")
+
+	client = &firehoseMockClient{}
+	sink = FirehoseSink{Client: client, DeliveryStream: "logs"}
+	err = sink.Put(context.Background(), Object{Data: []byte("a\n" + strings.Repeat("x", firehoseMaxRecordBytes) + "\n"), Codec: NoneCodec{}, Delimiter: []byte("\n")})
+	assert.ErrorContains(t, err, "exceeds the firehose limit")
+	assert.Empty(t, client.batches)
+}
@@ -0,0 +1,258 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Route sends the records matching Match to Logger. Match sees the record
+// level and all attributes of the record, including the handler's static
+// attributes and those added with slog.Logger.With.
+type Route struct {
+	Match  func(level slog.Level, attrs []slog.Attr) bool
+	Logger *S3Logger
+}
+
+// LevelRoute routes records of at least the given level.
+func LevelRoute(min slog.Leveler, l *S3Logger) Route {
+	return Route{
+		Match: func(level slog.Level, _ []slog.Attr) bool {
+			return level >= min.Level()
+		},
+		Logger: l,
+	}
+}
+
+// AttrRoute routes records carrying an attribute with the given key.
+func AttrRoute(key string, l *S3Logger) Route {
+	return Route{
+		Match: func(_ slog.Level, attrs []slog.Attr) bool {
+			for _, a := range attrs {
+				if a.Key == key {
+					return true
+				}
+			}
+			return false
+		},
+		Logger: l,
+	}
+}
+
+// SlogHandlerOptions configures a SlogHandler.
+type SlogHandlerOptions struct {
+	// HandlerOptions are used for the JSON encoding of all S3 destinations.
+	slog.HandlerOptions
+	// Attrs are added to every record, e.g. service, version and host.
+	Attrs []slog.Attr
+	// Routes receive every record they match.
+	Routes []Route
+	// Default receives the records matched by no route, nil drops them.
+	Default *S3Logger
+	// Also receive every record, e.g. slog.NewJSONHandler(os.Stdout, nil).
+	Also []slog.Handler
+	// Redaction is applied to the records written to S3, before a
+	// ReplaceAttr set in HandlerOptions.
+	Redaction *RedactionPolicy
+	// Sampling samples the records written to S3 by level and message, the
+	// Also handlers receive every record. The summary is written to S3 once
+	// the summary interval has passed after records were suppressed, until
+	// the handler is closed.
+	Sampling *SamplingPolicy
+}
+
+type routeHandler struct {
+	match   func(level slog.Level, attrs []slog.Attr) bool
+	handler slog.Handler
+}
+
+// SlogHandler is a slog.Handler writing JSON records to one or more
+// S3Loggers depending on their level or attributes.
+type SlogHandler struct {
+	routes   []routeHandler
+	fallback slog.Handler
+	also     []slog.Handler
+	attrs    []slog.Attr
+	sampler  *Sampler
+	root     *SlogHandler
+
+	summaryMutex sync.Mutex
+	summaryTimer *time.Timer
+	closed       bool
+}
+
+var _ slog.Handler = (*SlogHandler)(nil)
+
+func NewSlogHandler(opts SlogHandlerOptions) (*SlogHandler, error) {
+	var redactor *Redactor
+	if opts.Redaction != nil {
+		var err error
+		redactor, err = NewRedactor(*opts.Redaction)
+		if err != nil {
+			return nil, err
+		}
+	}
+	newHandler := func(l *S3Logger) slog.Handler {
+		var h slog.Handler = slog.NewJSONHandler(NewRecordWriter(l), &opts.HandlerOptions)
+		if redactor != nil {
+			h = redactor.Handler(h)
+		}
+		return h.WithAttrs(opts.Attrs)
+	}
+	h := &SlogHandler{attrs: opts.Attrs}
+	for _, r := range opts.Routes {
+		h.routes = append(h.routes, routeHandler{match: r.Match, handler: newHandler(r.Logger)})
+	}
+	if opts.Default != nil {
+		h.fallback = newHandler(opts.Default)
+	}
+	for _, a := range opts.Also {
+		h.also = append(h.also, a.WithAttrs(opts.Attrs))
+	}
+	if opts.Sampling != nil {
+		s, err := NewSampler(*opts.Sampling)
+		if err != nil {
+			return nil, err
+		}
+		h.sampler = s
+	}
+	h.root = h
+	return h, nil
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, child := range h.children() {
+		if child.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if h.sampler != nil && !h.sampler.Allow(r.Level.String()+" "+r.Message, time.Now()) {
+		h.root.scheduleSummary()
+		return h.handleAlso(ctx, r)
+	}
+	return errors.Join(h.handleS3(ctx, r), h.handleAlso(ctx, r))
+}
+
+// handleS3 writes r to the matching routes or the fallback.
+func (h *SlogHandler) handleS3(ctx context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, len(h.attrs)+r.NumAttrs())
+	attrs = append(attrs, h.attrs...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+
+	var errs []error
+	matched := false
+	for _, route := range h.routes {
+		if route.match(r.Level, attrs) {
+			matched = true
+			errs = append(errs, handleChild(ctx, route.handler, r))
+		}
+	}
+	if !matched && h.fallback != nil {
+		errs = append(errs, handleChild(ctx, h.fallback, r))
+	}
+	return errors.Join(errs...)
+}
+
+func (h *SlogHandler) handleAlso(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, a := range h.also {
+		errs = append(errs, handleChild(ctx, a, r))
+	}
+	return errors.Join(errs...)
+}
+
+func handleChild(ctx context.Context, child slog.Handler, r slog.Record) error {
+	if !child.Enabled(ctx, r.Level) {
+		return nil
+	}
+	return child.Handle(ctx, r.Clone())
+}
+
+// scheduleSummary arms a timer writing the sampling summary once the summary
+// interval has passed. It must be called on the root handler.
+func (h *SlogHandler) scheduleSummary() {
+	if h.sampler.policy.SummaryInterval <= 0 {
+		return
+	}
+	h.summaryMutex.Lock()
+	defer h.summaryMutex.Unlock()
+	if h.summaryTimer != nil || h.closed {
+		return
+	}
+	h.summaryTimer = time.AfterFunc(h.sampler.untilSummary(time.Now()), func() {
+		h.summaryMutex.Lock()
+		h.summaryTimer = nil
+		h.summaryMutex.Unlock()
+		h.writeSummary()
+	})
+}
+
+// Close stops the timer of a pending sampling summary, no summary is written
+// afterwards. It does not close the S3Loggers.
+func (h *SlogHandler) Close() {
+	h = h.root
+	h.summaryMutex.Lock()
+	defer h.summaryMutex.Unlock()
+	h.closed = true
+	if h.summaryTimer != nil {
+		h.summaryTimer.Stop()
+		h.summaryTimer = nil
+	}
+}
+
+func (h *SlogHandler) writeSummary() {
+	now := time.Now()
+	summary, ok := h.sampler.Summary(now)
+	if !ok {
+		return
+	}
+	r := slog.NewRecord(now, slog.LevelInfo, summary.Msg, 0)
+	r.AddAttrs(slog.Uint64("sampled", summary.Sampled), slog.Uint64("rate_limited", summary.RateLimited))
+	_ = h.handleS3(context.Background(), r)
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(child slog.Handler) slog.Handler { return child.WithAttrs(attrs) }, attrs)
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	return h.with(func(child slog.Handler) slog.Handler { return child.WithGroup(name) }, nil)
+}
+
+func (h *SlogHandler) with(fn func(child slog.Handler) slog.Handler, attrs []slog.Attr) *SlogHandler {
+	c := &SlogHandler{
+		attrs:   append(h.attrs[:len(h.attrs):len(h.attrs)], attrs...),
+		sampler: h.sampler,
+		root:    h.root,
+	}
+	for _, r := range h.routes {
+		c.routes = append(c.routes, routeHandler{match: r.match, handler: fn(r.handler)})
+	}
+	if h.fallback != nil {
+		c.fallback = fn(h.fallback)
+	}
+	for _, a := range h.also {
+		c.also = append(c.also, fn(a))
+	}
+	return c
+}
+
+func (h *SlogHandler) children() []slog.Handler {
+	children := make([]slog.Handler, 0, len(h.routes)+len(h.also)+1)
+	for _, r := range h.routes {
+		children = append(children, r.handler)
+	}
+	if h.fallback != nil {
+		children = append(children, h.fallback)
+	}
+	return append(children, h.also...)
+}
@@ -0,0 +1,95 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecordingLogger(t *testing.T, prefix string) (*S3Logger, chan interface{}) {
+	t.Helper()
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithPrefix(prefix))
+	require.NoError(t, err)
+	return l, client.debugChan
+}
+
+func flushedRecords(t *testing.T, l *S3Logger, ch chan interface{}) []map[string]any {
+	t.Helper()
+	l.Sync()
+	if len(ch) == 0 {
+		return nil
+	}
+	rs := (<-ch).(*s3.PutObjectInput)
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(readBody(t, rs)), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestSlogHandlerRouting(t *testing.T) {
+	all, allCh := newRecordingLogger(t, "all/")
+	errs, errsCh := newRecordingLogger(t, "errors/")
+	audit, auditCh := newRecordingLogger(t, "audit/")
+	var stdout bytes.Buffer
+
+	h, err := NewSlogHandler(SlogHandlerOptions{
+		Attrs:   []slog.Attr{slog.String("service", "curation"), slog.String("version", "1.2.3")},
+		Routes:  []Route{LevelRoute(slog.LevelError, errs), AttrRoute("audit", audit)},
+		Default: all,
+		Also:    []slog.Handler{slog.NewJSONHandler(&stdout, nil)},
+	})
+	require.NoError(t, err)
+	logger := slog.New(h)
+
+	logger.Info("plain")
+	logger.Error("failure", slog.String("reason", "timeout"))
+	logger.With(slog.Bool("audit", true)).WithGroup("req").Info("login", slog.String("user", "u1"))
+	logger.Debug("disabled")
+
+	allRecords := flushedRecords(t, all, allCh)
+	require.Len(t, allRecords, 1)
+	assert.Equal(t, "plain", allRecords[0]["msg"])
+	assert.Equal(t, "curation", allRecords[0]["service"])
+	assert.Equal(t, "1.2.3", allRecords[0]["version"])
+
+	errRecords := flushedRecords(t, errs, errsCh)
+	require.Len(t, errRecords, 1)
+	assert.Equal(t, "failure", errRecords[0]["msg"])
+	assert.Equal(t, "timeout", errRecords[0]["reason"])
+
+	auditRecords := flushedRecords(t, audit, auditCh)
+	require.Len(t, auditRecords, 1)
+	assert.Equal(t, "login", auditRecords[0]["msg"])
+	assert.Equal(t, true, auditRecords[0]["audit"])
+	assert.Equal(t, map[string]any{"user": "u1"}, auditRecords[0]["req"])
+
+	assert.Equal(t, 3, strings.Count(stdout.String(), "\n"))
+	assert.Equal(t, 3, strings.Count(stdout.String(), `"service":"curation"`))
+}
+
+func TestSlogHandlerEnabled(t *testing.T) {
+	l, _ := newRecordingLogger(t, "")
+	h, err := NewSlogHandler(SlogHandlerOptions{
+		HandlerOptions: slog.HandlerOptions{Level: slog.LevelWarn},
+		Default:        l,
+	})
+	require.NoError(t, err)
+	assert.False(t, h.Enabled(context.Background(), slog.LevelInfo))
+	assert.True(t, h.Enabled(context.Background(), slog.LevelWarn))
+
+	h, err = NewSlogHandler(SlogHandlerOptions{})
+	require.NoError(t, err)
+	assert.False(t, h.Enabled(context.Background(), slog.LevelError))
+}
@@ -0,0 +1,190 @@
+package s3logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// KeyInfo describes the chunk an object key is built for.
+type KeyInfo struct {
+	Prefix    string
+	Service   string
+	Host      string
+	FileID    string
+	Time      time.Time
+	Extension string
+}
+
+// KeyBuilder builds the object key of a chunk.
+type KeyBuilder func(info KeyInfo) string
+
+// DefaultKeyLayout builds keys like prefix2006/01/02/15/fileID-micros.gz.
+func DefaultKeyLayout(info KeyInfo) string {
+	return fmt.Sprintf("%s%s/%s-%d%s", info.Prefix, info.Time.Format("2006/01/02/15"), info.FileID, info.Time.UnixMicro(), info.Extension)
+}
+
+// HiveKeyLayout builds keys like
+// prefixyear=2006/month=01/day=02/hour=15/fileID-micros.gz.
+func HiveKeyLayout(info KeyInfo) string {
+	return fmt.Sprintf("%s%s/%s-%d%s", info.Prefix, HivePartitions(info.Time), info.FileID, info.Time.UnixMicro(), info.Extension)
+}
+
+// FlatKeyLayout puts all objects directly below the prefix, named
+// 20060102T150405.000000-fileID.gz so they sort by time.
+func FlatKeyLayout(info KeyInfo) string {
+	return fmt.Sprintf("%s%s-%s%s", info.Prefix, info.Time.Format("20060102T150405.000000"), info.FileID, info.Extension)
+}
+
+// HivePartitions formats t as year=2006/month=01/day=02/hour=15.
+func HivePartitions(t time.Time) string {
+	return t.Format("year=2006/month=01/day=02/hour=15")
+}
+
+var keyTemplateFuncs = template.FuncMap{
+	"hive": HivePartitions,
+	"hour": func(t time.Time) string { return t.Format("2006/01/02/15") },
+}
+
+// KeyTemplate builds keys from a text/template executed with KeyInfo, e.g.
+//
+//	{{.Prefix}}service={{.Service}}/{{hive .Time}}/{{.Host}}-{{.FileID}}-{{.Time.UnixMicro}}{{.Extension}}
+//
+// The functions hive and hour format a time as Hive partitions or as the
+// 2006/01/02/15 path of the default layout.
+//
+// The template must contain the FileID and the time with microsecond
+// precision, otherwise later chunks would overwrite earlier ones. It is
+// validated by executing it for times from year 1 to 9999. Should it still
+// fail for a key, the default layout is used.
+func KeyTemplate(text string) (KeyBuilder, error) {
+	execute, err := parseKeyTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(info KeyInfo) string {
+		key, err := execute(info)
+		if err != nil {
+			return DefaultKeyLayout(info)
+		}
+		return key
+	}, nil
+}
+
+// parseKeyTemplate parses and validates a key template.
+func parseKeyTemplate(text string) (func(info KeyInfo) (string, error), error) {
+	tmpl, err := template.New("key").Funcs(keyTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	execute := func(info KeyInfo) (string, error) {
+		var sb strings.Builder
+		err := tmpl.Execute(&sb, info)
+		return sb.String(), err
+	}
+	sample := KeyInfo{Prefix: "prefix/", Service: "service", Host: "host", FileID: "id", Time: time.Now(), Extension: ".gz"}
+	key, err := execute(sample)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range []time.Time{{}, time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC), sample.Time.In(time.FixedZone("", -12*3600))} {
+		other := sample
+		other.Time = t
+		_, err = execute(other)
+		if err != nil {
+			return nil, err
+		}
+	}
+	other := sample
+	other.FileID = "other-id"
+	if otherKey, _ := execute(other); otherKey == key {
+		return nil, errors.New("key template must contain the FileID")
+	}
+	other = sample
+	other.Time = sample.Time.Add(time.Microsecond)
+	if otherKey, _ := execute(other); otherKey == key {
+		return nil, errors.New("key template must contain the time with microsecond precision")
+	}
+	return execute, nil
+}
+
+func WithKeyBuilder(b KeyBuilder) Option {
+	return func(l *S3Logger) error {
+		if b == nil {
+			return errors.New("key builder must not be nil")
+		}
+		l.keyBuilder = b
+		return nil
+	}
+}
+
+// WithKeyTemplate builds keys with KeyTemplate. Keys the template fails for
+// use the default layout and the error is returned by the next Sync or
+// Close.
+func WithKeyTemplate(text string) Option {
+	return func(l *S3Logger) error {
+		execute, err := parseKeyTemplate(text)
+		if err != nil {
+			return err
+		}
+		l.keyBuilder = func(info KeyInfo) string {
+			key, err := execute(info)
+			if err != nil {
+				l.backgroundError(fmt.Errorf("could not build key: %w", err))
+				return DefaultKeyLayout(info)
+			}
+			return key
+		}
+		return nil
+	}
+}
+
+// WithKeyLocation sets the time zone of the time used in keys, it defaults
+// to time.Local.
+func WithKeyLocation(loc *time.Location) Option {
+	return func(l *S3Logger) error {
+		if loc == nil {
+			return errors.New("key location must not be nil")
+		}
+		l.keyLocation = loc
+		return nil
+	}
+}
+
+// WithService sets KeyInfo.Service.
+func WithService(name string) Option {
+	return func(l *S3Logger) error {
+		l.serviceName = name
+		return nil
+	}
+}
+
+// WithHost sets KeyInfo.Host, it defaults to os.Hostname.
+func WithHost(name string) Option {
+	return func(l *S3Logger) error {
+		l.host = name
+		return nil
+	}
+}
+
+func defaultHost() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+func (l *S3Logger) key(t time.Time) string {
+	return l.keyBuilder(KeyInfo{
+		Prefix:    l.prefix,
+		Service:   l.serviceName,
+		Host:      l.host,
+		FileID:    l.fileID,
+		Time:      t.In(l.keyLocation),
+		Extension: l.extension(),
+	})
+}
@@ -0,0 +1,77 @@
+package s3logger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var keyInfo = KeyInfo{
+	Prefix:    "logs/",
+	Service:   "curation",
+	Host:      "host-1",
+	FileID:    "id",
+	Time:      time.Date(2026, 10, 16, 9, 5, 7, 123456000, time.UTC),
+	Extension: ".gz",
+}
+
+func TestKeyLayouts(t *testing.T) {
+	assert.Equal(t, "logs/2026/10/16/09/id-1792141507123456.gz", DefaultKeyLayout(keyInfo))
+	assert.Equal(t, "logs/year=2026/month=10/day=16/hour=09/id-1792141507123456.gz", HiveKeyLayout(keyInfo))
+	assert.Equal(t, "logs/20261016T090507.123456-id.gz", FlatKeyLayout(keyInfo))
+}
+
+func TestKeyTemplate(t *testing.T) {
+	b, err := KeyTemplate("{{.Prefix}}service={{.Service}}/{{hive .Time}}/{{.Host}}-{{.FileID}}-{{.Time.UnixMicro}}{{.Extension}}")
+	require.NoError(t, err)
+	assert.Equal(t, "logs/service=curation/year=2026/month=10/day=16/hour=09/host-1-id-1792141507123456.gz", b(keyInfo))
+
+	b, err = KeyTemplate(`{{.Prefix}}{{hour .Time}}/{{.FileID}}-{{.Time.Format "04:05.000000"}}`)
+	require.NoError(t, err)
+	assert.Equal(t, "logs/2026/10/16/09/id-05:07.123456", b(keyInfo))
+
+	_, err = KeyTemplate("{{.Unknown}}")
+	assert.Error(t, err)
+	_, err = KeyTemplate("{{.Prefix")
+	assert.Error(t, err)
+	_, err = KeyTemplate(`{{.FileID}}-{{.Time.UnixMicro}}-{{(.Time.AddDate 1 0 0).MarshalText}}`)
+	assert.Error(t, err)
+	_, err = KeyTemplate("{{.Prefix}}{{hive .Time}}/{{.FileID}}{{.Extension}}")
+	assert.ErrorContains(t, err, "microsecond")
+	_, err = KeyTemplate("{{.Prefix}}{{.Time.UnixMicro}}{{.Extension}}")
+	assert.ErrorContains(t, err, "FileID")
+}
+
+func TestWithKeyTemplate(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithPrefix("logs/"),
+		WithService("curation"), WithKeyLocation(time.UTC),
+		WithKeyTemplate("{{.Prefix}}{{.Service}}/{{hive .Time}}/{{.FileID}}-{{.Time.UnixMicro}}{{.Extension}}"))
+	require.NoError(t, err)
+	l.now = func() time.Time { return keyInfo.Time }
+
+	require.NoError(t, l.Write([]byte("line\n")))
+	require.NoError(t, l.Sync())
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "logs/curation/year=2026/month=10/day=16/hour=09/"+l.fileID+"-1792141507123456.gz", *rs.Key)
+}
+
+func TestWithKeyTemplateReportsErrors(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithKeyLocation(time.UTC),
+		WithKeyTemplate("{{slice .Prefix 0 3}}/{{.FileID}}-{{.Time.UnixMicro}}{{.Extension}}"))
+	require.NoError(t, err)
+	l.now = func() time.Time { return keyInfo.Time }
+
+	require.NoError(t, l.Write([]byte("line\n")))
+	assert.ErrorContains(t, l.Sync(), "could not build key")
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "2026/10/16/09/"+l.fileID+"-1792141507123456.gz", *rs.Key)
+	assert.NoError(t, l.Sync())
+}
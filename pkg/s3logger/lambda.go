@@ -0,0 +1,245 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrNotInLambda is returned by StartLambdaExtension outside of AWS Lambda.
+var ErrNotInLambda = errors.New("s3logger: AWS_LAMBDA_RUNTIME_API is not set")
+
+const (
+	// lambdaFlushReserve is kept from the invocation deadline for returning
+	// the response.
+	lambdaFlushReserve = 100 * time.Millisecond
+	// lambdaSIGTERMGrace is the time Lambda waits between SIGTERM and SIGKILL.
+	lambdaSIGTERMGrace = 500 * time.Millisecond
+	lambdaExtensionAPI = "2020-01-01/extension"
+)
+
+// lambdaEventRetry is the backoff between failed requests for the next event.
+// The first retries are quick, as Lambda waits for the extension to ask for
+// the next event before it completes an invocation.
+var lambdaEventRetry = RetryPolicy{
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// LambdaLogger is implemented by S3Logger and ShardedLogger.
+type LambdaLogger interface {
+	SyncContext(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// LambdaHandler wraps a Lambda handler to sync l after every invocation, as
+// the environment is frozen between invocations and may be reaped without
+// notice. The sync waits for the chunks queued during the invocation and is
+// bounded by its deadline minus a reserve for returning the response. The
+// result of the handler is returned unchanged, sync errors do not fail the
+// invocation but are passed to onSyncError unless it is nil.
+func LambdaHandler[In, Out any](l LambdaLogger, handler func(context.Context, In) (Out, error), onSyncError func(error)) func(context.Context, In) (Out, error) {
+	return func(ctx context.Context, in In) (Out, error) {
+		out, err := handler(ctx, in)
+		syncCtx := context.WithoutCancel(ctx)
+		if deadline, ok := ctx.Deadline(); ok {
+			var cancel context.CancelFunc
+			syncCtx, cancel = context.WithDeadline(syncCtx, deadline.Add(-lambdaFlushReserve))
+			defer cancel()
+		}
+		if syncErr := l.SyncContext(syncCtx); syncErr != nil && onSyncError != nil {
+			onSyncError(syncErr)
+		}
+		return out, err
+	}
+}
+
+// LambdaExtensionOptions configures StartLambdaExtension.
+type LambdaExtensionOptions struct {
+	// Name of the extension, it defaults to the executable name as required
+	// for external extensions.
+	Name string
+	// External registers for the SHUTDOWN event, which only external
+	// extensions running in their own process receive. Internal extensions
+	// close the logger on SIGTERM instead, which Lambda sends to the
+	// function process on shutdown once an extension is registered.
+	External bool
+}
+
+// LambdaExtension closes a logger when the Lambda execution environment
+// shuts down.
+type LambdaExtension struct {
+	client *http.Client
+	base   string
+	id     string
+	logger LambdaLogger
+	done   chan struct{}
+	err    error
+
+	// apiErr is the last error of the Extensions API, it is reset once a
+	// request succeeds.
+	apiMutex sync.Mutex
+	apiErr   error
+}
+
+// StartLambdaExtension registers an extension with the Lambda Extensions API
+// and closes l once the execution environment shuts down. Extensions must
+// register during init, so call it before lambda.Start.
+func StartLambdaExtension(l LambdaLogger, opts LambdaExtensionOptions) (*LambdaExtension, error) {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		return nil, ErrNotInLambda
+	}
+	var sigterm chan os.Signal
+	if !opts.External {
+		sigterm = make(chan os.Signal, 1)
+		signal.Notify(sigterm, syscall.SIGTERM)
+	}
+	e, err := startLambdaExtension(l, opts, "http://"+api+"/"+lambdaExtensionAPI, sigterm)
+	if err != nil && sigterm != nil {
+		signal.Stop(sigterm)
+	}
+	return e, err
+}
+
+func startLambdaExtension(l LambdaLogger, opts LambdaExtensionOptions, base string, sigterm <-chan os.Signal) (*LambdaExtension, error) {
+	e := &LambdaExtension{client: &http.Client{}, base: base, logger: l, done: make(chan struct{})}
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	events := []string{"INVOKE"}
+	if opts.External {
+		events = append(events, "SHUTDOWN")
+	}
+	err := e.register(name, events)
+	if err != nil {
+		return nil, err
+	}
+	go e.run(sigterm)
+	return e, nil
+}
+
+// Done is closed once the logger was closed.
+func (e *LambdaExtension) Done() <-chan struct{} {
+	return e.done
+}
+
+// Err returns the error of closing the logger once Done is closed, joined
+// with the last error of the Extensions API if the extension still failed to
+// get events.
+func (e *LambdaExtension) Err() error {
+	<-e.done
+	return e.err
+}
+
+func (e *LambdaExtension) register(name string, events []string) error {
+	body, err := json.Marshal(map[string][]string{"events": events})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.base+"/register", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Lambda-Extension-Name", name)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not register lambda extension: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("could not register lambda extension: %s", resp.Status)
+	}
+	e.id = resp.Header.Get("Lambda-Extension-Identifier")
+	return nil
+}
+
+// lambdaEvent is an event of the Extensions API.
+type lambdaEvent struct {
+	EventType      string `json:"eventType"`
+	DeadlineMs     int64  `json:"deadlineMs"`
+	ShutdownReason string `json:"shutdownReason"`
+}
+
+func (e *LambdaExtension) next(ctx context.Context) (lambdaEvent, error) {
+	var ev lambdaEvent
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.base+"/event/next", nil)
+	if err != nil {
+		return ev, err
+	}
+	req.Header.Set("Lambda-Extension-Identifier", e.id)
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return ev, fmt.Errorf("could not get next lambda event: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ev, fmt.Errorf("could not get next lambda event: %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&ev)
+	return ev, err
+}
+
+// run polls the events and closes the logger on shutdown. Failed requests
+// for the next event are retried until the SHUTDOWN event or SIGTERM.
+func (e *LambdaExtension) run(sigterm <-chan os.Signal) {
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	shutdown := make(chan time.Time, 1)
+	go e.poll(pollCtx, shutdown)
+	var deadline time.Time
+	select {
+	case deadline = <-shutdown:
+	case <-sigterm:
+		deadline = time.Now().Add(lambdaSIGTERMGrace)
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), deadline.Add(-lambdaFlushReserve))
+	defer cancel()
+	err := e.logger.Close(ctx)
+	e.apiMutex.Lock()
+	e.err = errors.Join(err, e.apiErr)
+	e.apiMutex.Unlock()
+	close(e.done)
+}
+
+// poll gets the events until the SHUTDOWN event or until ctx is canceled.
+func (e *LambdaExtension) poll(ctx context.Context, shutdown chan<- time.Time) {
+	failures := 0
+	for {
+		ev, err := e.next(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		e.apiMutex.Lock()
+		e.apiErr = err
+		e.apiMutex.Unlock()
+		if err == nil {
+			failures = 0
+			if ev.EventType == "SHUTDOWN" {
+				shutdown <- time.UnixMilli(ev.DeadlineMs)
+				return
+			}
+			continue
+		}
+		failures++
+		timer := time.NewTimer(lambdaEventRetry.backoff(failures))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package s3logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLambdaHandler(t *testing.T) {
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithBatchFrequency(time.Hour), WithCodec(NoneCodec{}))
+	require.NoError(t, err)
+
+	handlerErr := errors.New("bad request")
+	handler := LambdaHandler(l, func(_ context.Context, name string) (string, error) {
+		if name == "" {
+			return "", handlerErr
+		}
+		return "hello " + name, l.WriteRecord([]byte(name))
+	}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	out, err := handler(ctx, "world")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", out)
+	require.Len(t, sink.objects, 1)
+	assert.Equal(t, "world\n", string(sink.objects[0].Data))
+
+	_, err = handler(context.Background(), "")
+	assert.ErrorIs(t, err, handlerErr)
+	assert.Len(t, sink.objects, 1)
+}
+
+func TestLambdaHandlerWaitsForQueuedChunks(t *testing.T) {
+	sink := &slowSink{delay: 200 * time.Millisecond}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithMaxRecords(2))
+	require.NoError(t, err)
+	handler := LambdaHandler(l, func(context.Context, int) (int, error) {
+		for i := 0; i < 5; i++ {
+			if err := l.WriteRecord([]byte("record")); err != nil {
+				return i, err
+			}
+		}
+		return 5, nil
+	}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = handler(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, sink.count())
+}
+
+func TestLambdaHandlerReportsSyncErrors(t *testing.T) {
+	uploadErr := errors.New("unavailable")
+	sink := &memorySink{errs: []error{uploadErr}}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	require.NoError(t, err)
+	var syncErrs []error
+	handler := LambdaHandler(l, func(_ context.Context, name string) (string, error) {
+		return "hello " + name, l.WriteRecord([]byte(name))
+	}, func(err error) { syncErrs = append(syncErrs, err) })
+
+	out, err := handler(context.Background(), "world")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", out)
+	require.Len(t, syncErrs, 1)
+	assert.ErrorIs(t, syncErrs[0], uploadErr)
+
+	handler = LambdaHandler(l, func(_ context.Context, name string) (string, error) {
+		return "hello " + name, l.WriteRecord([]byte(name))
+	}, nil)
+	sink.errs = []error{uploadErr}
+	out, err = handler(context.Background(), "again")
+	require.NoError(t, err)
+	assert.Equal(t, "hello again", out)
+}
+
+// lambdaExtensionServer fakes the Lambda Extensions API, sending events to the
+// extension once they are pushed to the events channel.
+type lambdaExtensionServer struct {
+	*httptest.Server
+	mutex      sync.Mutex
+	registered map[string]any
+	name       string
+	events     chan lambdaEvent
+	// failures is the number of requests for the next event that fail.
+	failures int
+}
+
+func newLambdaExtensionServer(t *testing.T) *lambdaExtensionServer {
+	s := &lambdaExtensionServer{events: make(chan lambdaEvent, 2)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /"+lambdaExtensionAPI+"/register", func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.name = r.Header.Get("Lambda-Extension-Name")
+		_ = json.NewDecoder(r.Body).Decode(&s.registered)
+		w.Header().Set("Lambda-Extension-Identifier", "extension-id")
+	})
+	mux.HandleFunc("GET /"+lambdaExtensionAPI+"/event/next", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Lambda-Extension-Identifier") != "extension-id" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		s.mutex.Lock()
+		failed := s.failures > 0
+		if failed {
+			s.failures--
+		}
+		s.mutex.Unlock()
+		if failed {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		select {
+		case ev := <-s.events:
+			_ = json.NewEncoder(w).Encode(ev)
+		case <-r.Context().Done():
+		}
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *lambdaExtensionServer) base() string {
+	return s.URL + "/" + lambdaExtensionAPI
+}
+
+func TestLambdaExtensionShutdownEvent(t *testing.T) {
+	server := newLambdaExtensionServer(t)
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithBatchFrequency(time.Hour))
+	require.NoError(t, err)
+
+	e, err := startLambdaExtension(l, LambdaExtensionOptions{Name: "s3logger", External: true}, server.base(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "s3logger", server.name)
+	assert.Equal(t, map[string]any{"events": []any{"INVOKE", "SHUTDOWN"}}, server.registered)
+
+	require.NoError(t, l.WriteRecord([]byte("last words")))
+	server.events <- lambdaEvent{EventType: "INVOKE", DeadlineMs: time.Now().Add(time.Second).UnixMilli()}
+	select {
+	case <-e.Done():
+		t.Fatal("extension stopped on INVOKE")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.events <- lambdaEvent{EventType: "SHUTDOWN", DeadlineMs: time.Now().Add(time.Second).UnixMilli(), ShutdownReason: "spindown"}
+	require.NoError(t, e.Err())
+	assert.Len(t, sink.objects, 1)
+	assert.ErrorIs(t, l.Write([]byte("too late\n")), ErrClosed)
+}
+
+func TestLambdaExtensionSIGTERM(t *testing.T) {
+	server := newLambdaExtensionServer(t)
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithBatchFrequency(time.Hour))
+	require.NoError(t, err)
+
+	sigterm := make(chan os.Signal, 1)
+	e, err := startLambdaExtension(l, LambdaExtensionOptions{}, server.base(), sigterm)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"events": []any{"INVOKE"}}, server.registered)
+	assert.NotEmpty(t, server.name)
+
+	require.NoError(t, l.WriteRecord([]byte("last words")))
+	sigterm <- syscall.SIGTERM
+	require.NoError(t, e.Err())
+	assert.Len(t, sink.objects, 1)
+}
+
+func TestLambdaExtensionRetriesEvents(t *testing.T) {
+	server := newLambdaExtensionServer(t)
+	server.failures = 3
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithBatchFrequency(time.Hour))
+	require.NoError(t, err)
+
+	e, err := startLambdaExtension(l, LambdaExtensionOptions{External: true}, server.base(), nil)
+	require.NoError(t, err)
+	require.NoError(t, l.WriteRecord([]byte("last words")))
+	select {
+	case <-e.Done():
+		t.Fatal("extension stopped on a failed request")
+	case <-time.After(200 * time.Millisecond):
+	}
+	assert.NoError(t, l.WriteRecord([]byte("still open")))
+
+	server.events <- lambdaEvent{EventType: "SHUTDOWN", DeadlineMs: time.Now().Add(time.Second).UnixMilli()}
+	require.NoError(t, e.Err())
+	assert.Len(t, sink.objects, 1)
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	assert.Zero(t, server.failures)
+}
+
+func TestLambdaExtensionErrors(t *testing.T) {
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", "")
+	_, err := StartLambdaExtension(&ShardedLogger{}, LambdaExtensionOptions{})
+	assert.ErrorIs(t, err, ErrNotInLambda)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	_, err = startLambdaExtension(&ShardedLogger{}, LambdaExtensionOptions{}, server.URL, nil)
+	assert.ErrorContains(t, err, fmt.Sprint(http.StatusForbidden))
+}
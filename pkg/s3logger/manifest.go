@@ -0,0 +1,292 @@
+package s3logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ManifestExtension is the extension of manifest objects. They are stored
+// next to the chunks, their key is built with the key builder of the logger
+// for the start of the hour.
+const ManifestExtension = ".manifest.json"
+
+// Manifest lists the chunks a logger uploaded for one hour of object keys.
+type Manifest struct {
+	Service string    `json:"service,omitempty"`
+	Host    string    `json:"host"`
+	FileID  string    `json:"file_id"`
+	Hour    time.Time `json:"hour"`
+	// Complete is set once the logger uploads chunks of a later hour or is
+	// closed, and no chunk of the hour is pending.
+	Complete bool            `json:"complete"`
+	Chunks   []ManifestChunk `json:"chunks"`
+}
+
+// ManifestChunk describes an uploaded object.
+type ManifestChunk struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	Records uint      `json:"records"`
+	First   time.Time `json:"first,omitzero"`
+	Last    time.Time `json:"last,omitzero"`
+	// ChecksumSHA256 is the base64 encoded checksum S3 stores with the
+	// object. Multipart uploads over 5 GiB carry the checksum of the part
+	// checksums.
+	ChecksumSHA256 string `json:"checksum_sha256,omitempty"`
+}
+
+// defaultManifestInterval is the minimum time between two rewrites of the
+// manifest of the current hour.
+const defaultManifestInterval = time.Minute
+
+type manifestState struct {
+	manifest Manifest
+	pending  int
+	// version counts the changes of the manifest, lastWrite is the time of
+	// the last snapshot and timer writes a snapshot once the manifest
+	// interval has passed.
+	version   int
+	lastWrite time.Time
+	timer     *time.Timer
+
+	// writeMutex orders the puts of the manifest, written is the version
+	// put last.
+	writeMutex sync.Mutex
+	written    int
+}
+
+// manifestSnapshot is a copy of a manifest written outside of
+// l.manifestMutex.
+type manifestSnapshot struct {
+	state    *manifestState
+	manifest Manifest
+	version  int
+}
+
+// snapshot copies the manifest and stops a pending timer. It must be called
+// with l.manifestMutex held.
+func (st *manifestState) snapshot() manifestSnapshot {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.lastWrite = time.Now()
+	m := st.manifest
+	m.Chunks = slices.Clone(m.Chunks)
+	return manifestSnapshot{state: st, manifest: m, version: st.version}
+}
+
+// WithManifest writes a manifest per logger and hour listing all uploaded
+// chunks, so consumers can verify they got everything. The manifest of an
+// hour is rewritten after an upload, at most once per manifest interval, and
+// when the hour is complete. Chunks spooled by an earlier process are listed
+// in the manifest of the process uploading them. Loggers with a sink hand the
+// manifests to it, New fails for the record sinks CloudWatchLogsSink and
+// FirehoseSink.
+func WithManifest() Option {
+	return func(l *S3Logger) error {
+		l.manifests = map[time.Time]*manifestState{}
+		return nil
+	}
+}
+
+// WithManifestInterval sets the minimum time between two rewrites of the
+// manifest of an hour, it defaults to a minute.
+func WithManifestInterval(d time.Duration) Option {
+	return func(l *S3Logger) error {
+		if d < 0 {
+			return errors.New("manifest interval must not be negative")
+		}
+		l.manifestInterval = d
+		return nil
+	}
+}
+
+// validateManifestKey rejects key builders which would store the manifest
+// under the key of a chunk.
+func (l *S3Logger) validateManifestKey() error {
+	info := KeyInfo{
+		Prefix:    l.prefix,
+		Service:   l.serviceName,
+		Host:      l.host,
+		FileID:    l.fileID,
+		Time:      l.manifestHour(l.now()),
+		Extension: l.extension(),
+	}
+	chunkKey := l.keyBuilder(info)
+	info.Extension = ManifestExtension
+	if l.keyBuilder(info) == chunkKey {
+		return errors.New("the key builder must use the extension if manifests are written")
+	}
+	return nil
+}
+
+func (l *S3Logger) manifestHour(t time.Time) time.Time {
+	t = t.In(l.keyLocation)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, l.keyLocation)
+}
+
+// manifestState returns the state of the hour, creating it if needed. It must
+// be called with l.manifestMutex held.
+func (l *S3Logger) manifestState(hour time.Time) *manifestState {
+	st, ok := l.manifests[hour]
+	if !ok {
+		st = &manifestState{manifest: Manifest{
+			Service: l.serviceName,
+			Host:    l.host,
+			FileID:  l.fileID,
+			Hour:    hour,
+			Chunks:  []ManifestChunk{},
+		}}
+		l.manifests[hour] = st
+	}
+	return st
+}
+
+// manifestChunkStarted registers a chunk whose key was built for t.
+func (l *S3Logger) manifestChunkStarted(t time.Time) {
+	if l.manifests == nil {
+		return
+	}
+	l.manifestMutex.Lock()
+	defer l.manifestMutex.Unlock()
+	hour := l.manifestHour(t)
+	l.manifestState(hour).pending++
+	if hour.After(l.latestHour) {
+		l.latestHour = hour
+	}
+}
+
+// manifestChunkFailed unregisters a chunk that could not be uploaded.
+func (l *S3Logger) manifestChunkFailed(t time.Time) {
+	if l.manifests == nil {
+		return
+	}
+	l.manifestMutex.Lock()
+	defer l.manifestMutex.Unlock()
+	st := l.manifestState(l.manifestHour(t))
+	if st.pending > 0 {
+		st.pending--
+	}
+}
+
+// manifestChunkUploaded adds an uploaded chunk to its manifest, writes it
+// if the manifest interval has passed and completes the manifests of earlier
+// hours without pending chunks.
+func (l *S3Logger) manifestChunkUploaded(ctx context.Context, t time.Time, entry ManifestChunk) error {
+	if l.manifests == nil {
+		return nil
+	}
+	l.manifestMutex.Lock()
+	hour := l.manifestHour(t)
+	st := l.manifestState(hour)
+	if st.pending > 0 {
+		st.pending--
+	}
+	st.manifest.Chunks = append(st.manifest.Chunks, entry)
+	st.version++
+	var due []manifestSnapshot
+	for h, other := range l.manifests {
+		if h.Before(l.latestHour) && other.pending == 0 {
+			other.manifest.Complete = true
+			other.version++
+			due = append(due, other.snapshot())
+			delete(l.manifests, h)
+		}
+	}
+	if _, ok := l.manifests[hour]; ok {
+		wait := l.manifestInterval - time.Since(st.lastWrite)
+		switch {
+		case wait <= 0:
+			due = append(due, st.snapshot())
+		case st.timer == nil:
+			st.timer = time.AfterFunc(wait, func() { l.writePendingManifest(hour) })
+		}
+	}
+	l.manifestMutex.Unlock()
+	return l.putManifests(ctx, due)
+}
+
+// writePendingManifest writes the manifest of an hour after the manifest
+// interval. Errors are reported to the observer, the manifest is written
+// again with the next upload or at Close.
+func (l *S3Logger) writePendingManifest(hour time.Time) {
+	l.manifestMutex.Lock()
+	st, ok := l.manifests[hour]
+	if !ok || st.timer == nil {
+		l.manifestMutex.Unlock()
+		return
+	}
+	snapshot := st.snapshot()
+	l.manifestMutex.Unlock()
+	_ = l.putManifest(context.Background(), snapshot)
+}
+
+// closeManifests writes all open manifests, completing those without pending
+// chunks.
+func (l *S3Logger) closeManifests(ctx context.Context) error {
+	if l.manifests == nil {
+		return nil
+	}
+	l.manifestMutex.Lock()
+	var due []manifestSnapshot
+	for h, st := range l.manifests {
+		st.manifest.Complete = st.pending == 0
+		st.version++
+		due = append(due, st.snapshot())
+		delete(l.manifests, h)
+	}
+	l.manifestMutex.Unlock()
+	return l.putManifests(ctx, due)
+}
+
+func (l *S3Logger) putManifests(ctx context.Context, snapshots []manifestSnapshot) error {
+	var errs []error
+	for _, snapshot := range snapshots {
+		errs = append(errs, l.putManifest(ctx, snapshot))
+	}
+	return errors.Join(errs...)
+}
+
+// putManifest writes a snapshot unless a later one was written already.
+func (l *S3Logger) putManifest(ctx context.Context, snapshot manifestSnapshot) error {
+	st := snapshot.state
+	st.writeMutex.Lock()
+	defer st.writeMutex.Unlock()
+	if snapshot.version <= st.written {
+		return nil
+	}
+	err := l.waitReady(ctx)
+	if err != nil {
+		return err
+	}
+	m := &snapshot.manifest
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	key := l.keyBuilder(KeyInfo{
+		Prefix:    l.prefix,
+		Service:   l.serviceName,
+		Host:      l.host,
+		FileID:    l.fileID,
+		Time:      m.Hour,
+		Extension: ManifestExtension,
+	})
+	err = l.putObject(ctx, OperationPutManifest, Object{
+		Key:         key,
+		Data:        data,
+		ContentType: "application/json",
+		Codec:       NoneCodec{},
+	})
+	if err != nil {
+		return fmt.Errorf("could not write manifest %s: %w", key, err)
+	}
+	st.written = snapshot.version
+	return nil
+}
@@ -0,0 +1,252 @@
+package s3logger
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// objectsS3Client keeps the objects put to it.
+type objectsS3Client struct {
+	s3MockClient
+	mutex   sync.Mutex
+	objects map[string]*s3.PutObjectInput
+	bodies  map[string][]byte
+	puts    map[string]int
+}
+
+func newObjectsS3Client() *objectsS3Client {
+	return &objectsS3Client{objects: map[string]*s3.PutObjectInput{}, bodies: map[string][]byte{}, puts: map[string]int{}}
+}
+
+func (c *objectsS3Client) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.objects[*params.Key] = params
+	c.bodies[*params.Key] = data
+	c.puts[*params.Key]++
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *objectsS3Client) manifests(t *testing.T) map[string]Manifest {
+	t.Helper()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	manifests := map[string]Manifest{}
+	for key, data := range c.bodies {
+		if strings.HasSuffix(key, ManifestExtension) {
+			var m Manifest
+			require.NoError(t, json.Unmarshal(data, &m))
+			manifests[key] = m
+		}
+	}
+	return manifests
+}
+
+func TestManifest(t *testing.T) {
+	client := newObjectsS3Client()
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithManifest(),
+		WithPrefix("logs/"), WithService("curation"), WithKeyLocation(time.UTC))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("one\n")))
+	require.NoError(t, l.Write([]byte("two\n")))
+	l.Sync()
+	manifests := client.manifests(t)
+	require.Len(t, manifests, 1)
+	for _, m := range manifests {
+		assert.False(t, m.Complete)
+		assert.Len(t, m.Chunks, 1)
+	}
+
+	require.NoError(t, l.Write([]byte("three\n")))
+	require.NoError(t, l.Close(context.Background()))
+
+	manifests = client.manifests(t)
+	require.Len(t, manifests, 1)
+	for key, m := range manifests {
+		hour := time.Now().UTC().Truncate(time.Hour)
+		assert.Equal(t, DefaultKeyLayout(KeyInfo{Prefix: "logs/", FileID: l.fileID, Time: hour, Extension: ManifestExtension}), key)
+		assert.Equal(t, "curation", m.Service)
+		assert.Equal(t, l.fileID, m.FileID)
+		assert.True(t, m.Hour.Equal(hour))
+		assert.True(t, m.Complete)
+		require.Len(t, m.Chunks, 2)
+		assert.Equal(t, uint(2), m.Chunks[0].Records)
+		assert.Equal(t, uint(1), m.Chunks[1].Records)
+		for _, chunk := range m.Chunks {
+			obj := client.objects[chunk.Key]
+			require.NotNil(t, obj, chunk.Key)
+			assert.Equal(t, aws.ToString(obj.ChecksumSHA256), chunk.ChecksumSHA256)
+			assert.Equal(t, int64(len(client.bodies[chunk.Key])), chunk.Size)
+			assert.False(t, chunk.Last.Before(chunk.First))
+		}
+	}
+}
+
+func TestManifestCompletesEarlierHours(t *testing.T) {
+	client := newObjectsS3Client()
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithManifest(), WithKeyLocation(time.UTC))
+	require.NoError(t, err)
+	ctx := context.Background()
+	ten := time.Date(2024, 3, 1, 10, 59, 0, 0, time.UTC)
+	eleven := ten.Add(2 * time.Minute)
+	manifest := func(hour time.Time) Manifest {
+		return client.manifests(t)[DefaultKeyLayout(KeyInfo{FileID: l.fileID, Time: hour.Truncate(time.Hour), Extension: ManifestExtension})]
+	}
+
+	// two chunks of 10:00 are in flight when the first chunk of 11:00 is done
+	l.manifestChunkStarted(ten)
+	l.manifestChunkStarted(ten)
+	l.manifestChunkStarted(eleven)
+	require.NoError(t, l.manifestChunkUploaded(ctx, eleven, ManifestChunk{Key: "c"}))
+	require.NoError(t, l.manifestChunkUploaded(ctx, ten, ManifestChunk{Key: "a"}))
+	assert.False(t, manifest(ten).Complete)
+
+	// the second one failed
+	l.manifestChunkFailed(ten)
+	l.manifestChunkStarted(eleven)
+	require.NoError(t, l.manifestChunkUploaded(ctx, eleven, ManifestChunk{Key: "d"}))
+	assert.True(t, manifest(ten).Complete)
+	assert.Equal(t, []ManifestChunk{{Key: "a"}}, manifest(ten).Chunks)
+	assert.False(t, manifest(eleven).Complete)
+
+	// a chunk still pending at close leaves the manifest incomplete
+	l.manifestChunkStarted(eleven)
+	require.NoError(t, l.Close(ctx))
+	assert.False(t, manifest(eleven).Complete)
+	assert.Equal(t, []ManifestChunk{{Key: "c"}, {Key: "d"}}, manifest(eleven).Chunks)
+}
+
+func TestManifestInterval(t *testing.T) {
+	client := newObjectsS3Client()
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithManifest(),
+		WithManifestInterval(100*time.Millisecond), WithKeyLocation(time.UTC))
+	require.NoError(t, err)
+	defer l.Close(context.Background())
+	key := DefaultKeyLayout(KeyInfo{FileID: l.fileID, Time: time.Now().UTC().Truncate(time.Hour), Extension: ManifestExtension})
+	puts := func() int {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+		return client.puts[key]
+	}
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Write([]byte("line\n")))
+		require.NoError(t, l.Sync())
+	}
+	assert.Equal(t, 1, puts())
+	assert.Len(t, client.manifests(t)[key].Chunks, 1)
+
+	assert.Eventually(t, func() bool { return puts() == 2 }, time.Second, 10*time.Millisecond)
+	assert.Len(t, client.manifests(t)[key].Chunks, 5)
+}
+
+// blockingManifestClient blocks the puts of manifests until release is
+// closed.
+type blockingManifestClient struct {
+	*objectsS3Client
+	release chan struct{}
+}
+
+func (c blockingManifestClient) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if strings.HasSuffix(*params.Key, ManifestExtension) {
+		<-c.release
+	}
+	return c.objectsS3Client.PutObject(ctx, params, optFns...)
+}
+
+func TestManifestWriteDoesNotHoldLock(t *testing.T) {
+	client := blockingManifestClient{objectsS3Client: newObjectsS3Client(), release: make(chan struct{})}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithManifest(), WithUploadConcurrency(2))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("first\n")))
+	synced := make(chan error)
+	go func() { synced <- l.Sync() }()
+	assert.Eventually(t, func() bool {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+		return len(client.objects) == 1
+	}, time.Second, time.Millisecond)
+
+	locked := make(chan struct{})
+	go func() {
+		l.manifestChunkStarted(time.Now())
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("manifest lock held while writing")
+	}
+	close(client.release)
+	require.NoError(t, <-synced)
+	l.manifestChunkFailed(time.Now())
+	require.NoError(t, l.Close(context.Background()))
+}
+
+func TestManifestKeyNeedsExtension(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithManifest(),
+		WithKeyTemplate("{{.Prefix}}{{.FileID}}-{{.Time.UnixMicro}}"))
+	assert.Error(t, err)
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(),
+		WithKeyTemplate("{{.Prefix}}{{.FileID}}-{{.Time.UnixMicro}}"))
+	assert.NoError(t, err)
+}
+
+func TestManifestMultipart(t *testing.T) {
+	client := &multipartMockClient{}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(NoneCodec{}), WithManifest(),
+		WithMaxFileSize(100*MinPartSize), WithMultipartUpload(MinPartSize))
+	require.NoError(t, err)
+	l.partSize = 1024
+
+	var manifest []byte
+	l.service = manifestCapture{S3Client: client, manifest: &manifest}
+	l.sink = l.s3Sink()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.Write([]byte(strings.Repeat("z", 99)+"\n")))
+	}
+	require.NoError(t, l.Close(context.Background()))
+
+	var m Manifest
+	require.NoError(t, json.Unmarshal(manifest, &m))
+	require.Len(t, m.Chunks, 1)
+	assert.Equal(t, int64(len(client.objects[m.Chunks[0].Key])), m.Chunks[0].Size)
+	assert.Equal(t, uint(100), m.Chunks[0].Records)
+	assert.Equal(t, "composite-10", m.Chunks[0].ChecksumSHA256)
+	assert.True(t, m.Complete)
+}
+
+// manifestCapture keeps the last manifest put to the wrapped client.
+type manifestCapture struct {
+	S3Client
+	manifest *[]byte
+}
+
+func (c manifestCapture) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if strings.HasSuffix(*params.Key, ManifestExtension) {
+		data, err := io.ReadAll(params.Body)
+		if err != nil {
+			return nil, err
+		}
+		*c.manifest = data
+		return &s3.PutObjectOutput{}, nil
+	}
+	return c.S3Client.PutObject(ctx, params, optFns...)
+}
@@ -0,0 +1,167 @@
+package s3logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Metrics is an Observer counting the work of one or more loggers. It serves
+// the counters in the Prometheus text format, e.g. mounted at /metrics.
+type Metrics struct {
+	mutex      sync.Mutex
+	inProgress int64
+	uploads    map[uploadMetricKey]*uploadCounters
+	chunks     ChunkEvent
+	chunkCount uint64
+	dropped    map[DropReason]uint64
+	stats      []func() Stats
+}
+
+type uploadMetricKey struct {
+	operation UploadOperation
+	result    string
+}
+
+type uploadCounters struct {
+	attempts uint64
+	bytes    uint64
+	seconds  float64
+}
+
+var _ Observer = (*Metrics)(nil)
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		uploads: map[uploadMetricKey]*uploadCounters{},
+		dropped: map[DropReason]uint64{},
+	}
+}
+
+// ReportStats adds the Stats of a logger to the gauges, e.g.
+// m.ReportStats(l.Stats).
+func (m *Metrics) ReportStats(stats func() Stats) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stats = append(m.stats, stats)
+}
+
+func (m *Metrics) UploadAttempt(UploadEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inProgress++
+}
+
+func (m *Metrics) UploadResult(e UploadEvent) {
+	key := uploadMetricKey{operation: e.Operation, result: "success"}
+	if e.Err != nil {
+		key.result = "error"
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inProgress--
+	c, ok := m.uploads[key]
+	if !ok {
+		c = &uploadCounters{}
+		m.uploads[key] = c
+	}
+	c.attempts++
+	c.bytes += uint64(e.Bytes)
+	c.seconds += e.Latency.Seconds()
+}
+
+func (m *Metrics) ChunkCut(e ChunkEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.chunkCount++
+	m.chunks.Records += e.Records
+	m.chunks.UncompressedBytes += e.UncompressedBytes
+	m.chunks.Bytes += e.Bytes
+}
+
+func (m *Metrics) Dropped(e DropEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.dropped[e.Reason] += e.Records
+}
+
+// WriteTo writes the metrics in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	stats := m.stats
+	var buf bytes.Buffer
+	keys := make([]uploadMetricKey, 0, len(m.uploads))
+	for k := range m.uploads {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].operation != keys[j].operation {
+			return keys[i].operation < keys[j].operation
+		}
+		return keys[i].result < keys[j].result
+	})
+	header(&buf, "s3logger_upload_attempts_total", "counter", "Upload attempts by S3 operation and result.")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "s3logger_upload_attempts_total{operation=%q,result=%q} %d\n", k.operation, k.result, m.uploads[k].attempts)
+	}
+	header(&buf, "s3logger_upload_bytes_total", "counter", "Bytes sent by upload attempts.")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "s3logger_upload_bytes_total{operation=%q,result=%q} %d\n", k.operation, k.result, m.uploads[k].bytes)
+	}
+	header(&buf, "s3logger_upload_duration_seconds", "summary", "Latency of upload attempts.")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "s3logger_upload_duration_seconds_sum{operation=%q,result=%q} %g\n", k.operation, k.result, m.uploads[k].seconds)
+		fmt.Fprintf(&buf, "s3logger_upload_duration_seconds_count{operation=%q,result=%q} %d\n", k.operation, k.result, m.uploads[k].attempts)
+	}
+	header(&buf, "s3logger_uploads_in_progress", "gauge", "Upload attempts in progress.")
+	fmt.Fprintf(&buf, "s3logger_uploads_in_progress %d\n", m.inProgress)
+	header(&buf, "s3logger_chunks_total", "counter", "Chunks cut for upload.")
+	fmt.Fprintf(&buf, "s3logger_chunks_total %d\n", m.chunkCount)
+	header(&buf, "s3logger_chunk_records_total", "counter", "Records in chunks cut for upload.")
+	fmt.Fprintf(&buf, "s3logger_chunk_records_total %d\n", m.chunks.Records)
+	header(&buf, "s3logger_chunk_uncompressed_bytes_total", "counter", "Uncompressed bytes of chunks cut for upload.")
+	fmt.Fprintf(&buf, "s3logger_chunk_uncompressed_bytes_total %d\n", m.chunks.UncompressedBytes)
+	header(&buf, "s3logger_chunk_bytes_total", "counter", "Compressed bytes of chunks cut for upload.")
+	fmt.Fprintf(&buf, "s3logger_chunk_bytes_total %d\n", m.chunks.Bytes)
+	reasons := make([]string, 0, len(m.dropped))
+	for r := range m.dropped {
+		reasons = append(reasons, string(r))
+	}
+	sort.Strings(reasons)
+	header(&buf, "s3logger_dropped_records_total", "counter", "Records discarded by reason.")
+	for _, r := range reasons {
+		fmt.Fprintf(&buf, "s3logger_dropped_records_total{reason=%q} %d\n", r, m.dropped[DropReason(r)])
+	}
+	m.mutex.Unlock()
+
+	// Stats locks the logger, which may call the observer while locked
+	if len(stats) > 0 {
+		var sum Stats
+		for _, s := range stats {
+			st := s()
+			sum.BufferedBytes += st.BufferedBytes
+			sum.InFlightBytes += st.InFlightBytes
+			sum.QueuedChunks += st.QueuedChunks
+		}
+		header(&buf, "s3logger_buffered_bytes", "gauge", "Compressed bytes buffered in the current chunks.")
+		fmt.Fprintf(&buf, "s3logger_buffered_bytes %d\n", sum.BufferedBytes)
+		header(&buf, "s3logger_in_flight_bytes", "gauge", "Bytes of chunks queued or uploading.")
+		fmt.Fprintf(&buf, "s3logger_in_flight_bytes %d\n", sum.InFlightBytes)
+		header(&buf, "s3logger_queued_chunks", "gauge", "Chunks waiting for an upload worker.")
+		fmt.Fprintf(&buf, "s3logger_queued_chunks %d\n", sum.QueuedChunks)
+	}
+	return buf.WriteTo(w)
+}
+
+func header(buf *bytes.Buffer, name, typ, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
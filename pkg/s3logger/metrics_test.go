@@ -0,0 +1,70 @@
+package s3logger
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	m.UploadAttempt(UploadEvent{Operation: OperationPutObject})
+	m.UploadResult(UploadEvent{Operation: OperationPutObject, Attempt: 1, Bytes: 100, Latency: time.Second, Err: errors.New("throttled")})
+	m.UploadAttempt(UploadEvent{Operation: OperationPutObject})
+	m.UploadResult(UploadEvent{Operation: OperationPutObject, Attempt: 2, Bytes: 100, Latency: 500 * time.Millisecond})
+	m.UploadAttempt(UploadEvent{Operation: OperationUploadPart})
+	m.ChunkCut(ChunkEvent{Records: 3, UncompressedBytes: 300, Bytes: 100})
+	m.Dropped(DropEvent{Reason: DropSampled, Records: 1})
+	m.Dropped(DropEvent{Reason: DropSampled, Records: 1})
+	m.Dropped(DropEvent{Reason: DropOverflow, Records: 5})
+	m.ReportStats(func() Stats { return Stats{BufferedBytes: 10, InFlightBytes: 20, QueuedChunks: 1} })
+	m.ReportStats(func() Stats { return Stats{BufferedBytes: 5} })
+
+	var sb strings.Builder
+	_, err := m.WriteTo(&sb)
+	require.NoError(t, err)
+	out := sb.String()
+	for _, line := range []string{
+		`s3logger_upload_attempts_total{operation="PutObject",result="error"} 1`,
+		`s3logger_upload_attempts_total{operation="PutObject",result="success"} 1`,
+		`s3logger_upload_bytes_total{operation="PutObject",result="success"} 100`,
+		`s3logger_upload_duration_seconds_sum{operation="PutObject",result="error"} 1`,
+		`s3logger_upload_duration_seconds_sum{operation="PutObject",result="success"} 0.5`,
+		`s3logger_upload_duration_seconds_count{operation="PutObject",result="success"} 1`,
+		`s3logger_uploads_in_progress 1`,
+		`s3logger_chunks_total 1`,
+		`s3logger_chunk_records_total 3`,
+		`s3logger_chunk_uncompressed_bytes_total 300`,
+		`s3logger_chunk_bytes_total 100`,
+		`s3logger_dropped_records_total{reason="overflow"} 5`,
+		`s3logger_dropped_records_total{reason="sampled"} 2`,
+		`s3logger_buffered_bytes 15`,
+		`s3logger_in_flight_bytes 20`,
+		`s3logger_queued_chunks 1`,
+		`# TYPE s3logger_upload_attempts_total counter`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestMetricsWithLogger(t *testing.T) {
+	m := NewMetrics()
+	l, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithObserver(m))
+	require.NoError(t, err)
+	m.ReportStats(l.Stats)
+
+	require.NoError(t, l.Write([]byte("line\n")))
+	l.Sync()
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `s3logger_upload_attempts_total{operation="PutObject",result="success"} 1`+"\n")
+	assert.Contains(t, rec.Body.String(), "s3logger_chunk_records_total 1\n")
+	assert.Contains(t, rec.Body.String(), "s3logger_in_flight_bytes 0\n")
+}
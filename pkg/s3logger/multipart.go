@@ -0,0 +1,238 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// MinPartSize is the smallest part size S3 accepts for all but the last part
+// of a multipart upload.
+const MinPartSize = 5 * 1024 * 1024
+
+const abortTimeout = 30 * time.Second
+
+// WithMultipartUpload streams the compressed chunk to S3 in parts of
+// partSize bytes instead of keeping it in memory until the next sync. Only
+// the current and one in-flight part are held in memory, so WithMaxFileSize
+// can be raised far above the part size. The object key is taken when the
+// first part is cut. If the stream fails, the upload is aborted and the
+// UploadErrorHandler is called with a nil payload. Chunks smaller than one
+// part are uploaded with a single PutObject. The record count and the time
+// of the last record are unknown when the upload is created, so these
+// objects only carry the time of the first record as metadata.
+func WithMultipartUpload(partSize uint) Option {
+	return func(l *S3Logger) error {
+		if partSize < MinPartSize {
+			return fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+		}
+		l.partSize = partSize
+		return nil
+	}
+}
+
+type multipartUpload struct {
+	key       string
+	time      time.Time
+	uploadID  string
+	parts     chan []byte
+	sent      uint
+	completed []types.CompletedPart
+	checksum  string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+	// first is the time of the first record.
+	first time.Time
+
+	// numbered counts the parts cut so far and is guarded by l.mutex. Parts
+	// are handed over without l.mutex, so next orders them by number.
+	numbered int
+	mutex    sync.Mutex
+	turn     *sync.Cond
+	next     int
+}
+
+// part is a part cut from a multipart upload, to be handed over once
+// l.mutex is released.
+type part struct {
+	mp     *multipartUpload
+	number int
+	data   []byte
+}
+
+// cutPart cuts the buffered part of the multipart upload, starting the
+// upload first if needed. It must be called with l.mutex held, the part is
+// handed over with send after releasing it.
+func (l *S3Logger) cutPart() *part {
+	if l.multipart == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		now := l.now()
+		l.multipart = &multipartUpload{
+			key:    l.key(now),
+			time:   now,
+			first:  l.oldestRecord,
+			parts:  make(chan []byte, 1),
+			ctx:    ctx,
+			cancel: cancel,
+			done:   make(chan struct{}),
+		}
+		l.multipart.turn = sync.NewCond(&l.multipart.mutex)
+		l.manifestChunkStarted(now)
+		go l.runMultipart(l.multipart)
+	}
+	data := bytes.Clone(l.buffer.Bytes())
+	l.buffer.Reset()
+	l.multipart.sent += uint(len(data))
+	return l.multipart.number(data)
+}
+
+// number assigns the next part number to data. It must be called with
+// l.mutex held.
+func (mp *multipartUpload) number(data []byte) *part {
+	p := &part{mp: mp, number: mp.numbered, data: data}
+	mp.numbered++
+	return p
+}
+
+// send hands the part to the upload once all parts cut before were handed
+// over. It blocks while the previous part is still uploading and gives up
+// once the upload is canceled.
+func (p *part) send() {
+	mp := p.mp
+	mp.mutex.Lock()
+	for mp.next != p.number {
+		mp.turn.Wait()
+	}
+	mp.mutex.Unlock()
+	if len(p.data) > 0 {
+		select {
+		case mp.parts <- p.data:
+		case <-mp.ctx.Done():
+		}
+	}
+	mp.mutex.Lock()
+	mp.next++
+	mp.turn.Broadcast()
+	mp.mutex.Unlock()
+}
+
+// finish sends the last part and ends the upload.
+func (p *part) finish() {
+	p.send()
+	close(p.mp.parts)
+}
+
+// completeMultipart sends the last part and waits until the upload is
+// completed or aborted.
+func (l *S3Logger) completeMultipart(ctx context.Context, last *part, info chunkInfo) error {
+	mp := last.mp
+	go last.finish()
+	select {
+	case <-mp.done:
+	case <-ctx.Done():
+		mp.cancel()
+		<-mp.done
+	}
+	if mp.err != nil {
+		l.deadLetter(mp.key, nil, mp.err)
+		l.observer.Dropped(DropEvent{Reason: DropUploadFailed, Records: uint64(info.Records)})
+		l.manifestChunkFailed(mp.time)
+		return mp.err
+	}
+	return l.manifestChunkUploaded(ctx, mp.time, ManifestChunk{
+		Key:            mp.key,
+		Size:           int64(mp.sent) + int64(len(last.data)),
+		Records:        info.Records,
+		First:          info.First,
+		Last:           info.Last,
+		ChecksumSHA256: mp.checksum,
+	})
+}
+
+func (l *S3Logger) runMultipart(mp *multipartUpload) {
+	defer close(mp.done)
+	defer mp.cancel()
+	for part := range mp.parts {
+		if mp.err != nil {
+			continue
+		}
+		mp.err = l.uploadPart(mp, part)
+	}
+	if mp.err == nil {
+		mp.err = l.retryPolicy.do(mp.ctx, l.observed(OperationCompleteMultipart, mp.key, 0, func(ctx context.Context) error {
+			out, err := l.service.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+				Bucket:          aws.String(l.bucket),
+				Key:             aws.String(mp.key),
+				UploadId:        aws.String(mp.uploadID),
+				MultipartUpload: &types.CompletedMultipartUpload{Parts: mp.completed},
+			}, l.s3Options()...)
+			if err == nil && out != nil {
+				mp.checksum = aws.ToString(out.ChecksumSHA256)
+			}
+			return err
+		}))
+	}
+	if mp.err != nil && mp.uploadID != "" {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(mp.ctx), abortTimeout)
+		defer cancel()
+		_, err := l.service.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(l.bucket),
+			Key:      aws.String(mp.key),
+			UploadId: aws.String(mp.uploadID),
+		})
+		if err != nil {
+			mp.err = errors.Join(mp.err, fmt.Errorf("could not abort multipart upload: %w", err))
+		}
+	}
+}
+
+func (l *S3Logger) uploadPart(mp *multipartUpload, part []byte) error {
+	if mp.uploadID == "" {
+		err := l.waitReady(mp.ctx)
+		if err != nil {
+			return err
+		}
+		input := l.createMultipartUploadInput(mp.key, mp.first)
+		err = l.retryPolicy.do(mp.ctx, l.observed(OperationCreateMultipart, mp.key, 0, func(ctx context.Context) error {
+			out, err := l.service.CreateMultipartUpload(ctx, input, l.s3Options()...)
+			if err == nil {
+				mp.uploadID = aws.ToString(out.UploadId)
+			}
+			return err
+		}))
+		if err != nil {
+			return fmt.Errorf("could not create multipart upload: %w", err)
+		}
+	}
+	number := aws.Int32(int32(len(mp.completed) + 1))
+	sha256Sum, md5Sum := checksums(part)
+	return l.retryPolicy.do(mp.ctx, l.observed(OperationUploadPart, mp.key, len(part), func(ctx context.Context) error {
+		out, err := l.service.UploadPart(ctx, &s3.UploadPartInput{
+			Body:           bytes.NewReader(part),
+			Bucket:         aws.String(l.bucket),
+			Key:            aws.String(mp.key),
+			UploadId:       aws.String(mp.uploadID),
+			PartNumber:     number,
+			ChecksumSHA256: aws.String(sha256Sum),
+			ContentMD5:     aws.String(md5Sum),
+		}, l.s3Options()...)
+		if err != nil {
+			return err
+		}
+		mp.completed = append(mp.completed, types.CompletedPart{
+			ETag:           out.ETag,
+			PartNumber:     number,
+			ChecksumSHA256: aws.String(sha256Sum),
+		})
+		return nil
+	}))
+}
@@ -0,0 +1,193 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type multipartMockClient struct {
+	s3MockClient
+	mutex     sync.Mutex
+	parts     map[int32][]byte
+	objects   map[string][]byte
+	created   []*s3.CreateMultipartUploadInput
+	aborted   bool
+	failParts bool
+	// blockParts hangs every part upload until it is canceled
+	blockParts bool
+}
+
+func (c *multipartMockClient) UploadPart(ctx context.Context, params *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if c.failParts {
+		return nil, errors.New("connection reset")
+	}
+	if c.blockParts {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	if sha256Sum, md5Sum := checksums(data); aws.ToString(params.ChecksumSHA256) != sha256Sum || aws.ToString(params.ContentMD5) != md5Sum {
+		return nil, errors.New("checksum mismatch")
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.parts == nil {
+		c.parts = map[int32][]byte{}
+	}
+	c.parts[*params.PartNumber] = data
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+}
+
+func (c *multipartMockClient) CompleteMultipartUpload(_ context.Context, params *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var object []byte
+	for _, p := range params.MultipartUpload.Parts {
+		if p.ChecksumSHA256 == nil {
+			return nil, errors.New("part checksum missing")
+		}
+		object = append(object, c.parts[*p.PartNumber]...)
+	}
+	if c.objects == nil {
+		c.objects = map[string][]byte{}
+	}
+	c.objects[*params.Key] = object
+	return &s3.CompleteMultipartUploadOutput{ChecksumSHA256: aws.String("composite-" + fmt.Sprint(len(params.MultipartUpload.Parts)))}, nil
+}
+
+func (c *multipartMockClient) CreateMultipartUpload(_ context.Context, params *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.created = append(c.created, params)
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (c *multipartMockClient) AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestMultipartUpload(t *testing.T) {
+	client := &multipartMockClient{}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(NoneCodec{}),
+		WithMaxFileSize(100*MinPartSize), WithMultipartUpload(MinPartSize))
+	require.NoError(t, err)
+	l.partSize = 64 * 1024
+
+	var expected bytes.Buffer
+	for i := 0; expected.Len() < 1_000_000; i++ {
+		line := []byte(strings.Repeat("x", i%100) + "\n")
+		expected.Write(line)
+		require.NoError(t, l.Write(line))
+	}
+	require.NoError(t, l.Close(context.Background()))
+
+	require.Len(t, client.objects, 1)
+	assert.Greater(t, len(client.parts), 10)
+	for key, object := range client.objects {
+		assert.Equal(t, expected.Bytes(), object)
+
+		require.Len(t, client.created, 1)
+		created := client.created[0]
+		assert.Equal(t, key, *created.Key)
+		assert.Contains(t, created.Metadata, MetadataFirstRecord)
+		assert.NotContains(t, created.Metadata, MetadataRecordCount)
+	}
+	assert.False(t, client.aborted)
+}
+
+func TestMultipartDoesNotBlockWritersOrClose(t *testing.T) {
+	client := &multipartMockClient{blockParts: true}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(NoneCodec{}),
+		WithMaxFileSize(100*MinPartSize), WithMultipartUpload(MinPartSize), WithOnUploadError(func(string, []byte, error) {}))
+	require.NoError(t, err)
+	l.partSize = 1024
+
+	// the first part is uploading, the second waits for it and the third
+	// waits to be handed over
+	line := []byte(strings.Repeat("z", 1023) + "\n")
+	require.NoError(t, l.Write(line))
+	require.NoError(t, l.Write(line))
+	handedOver := make(chan error, 1)
+	go func() { handedOver <- l.Write(line) }()
+	assert.Eventually(t, func() bool {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return l.multipart.sent == 3*1024
+	}, time.Second, time.Millisecond)
+
+	written := make(chan error, 1)
+	go func() { written <- l.Write([]byte("small\n")) }()
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("writer blocked by a pending part")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Error(t, l.Close(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.NoError(t, <-handedOver)
+	assert.True(t, client.aborted)
+}
+
+func TestMultipartUploadAbortsOnFailure(t *testing.T) {
+	client := &multipartMockClient{failParts: true}
+	var payload []byte
+	var called bool
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(NoneCodec{}),
+		WithMaxFileSize(100*MinPartSize), WithMultipartUpload(MinPartSize),
+		WithOnUploadError(func(_ string, p []byte, _ error) { called, payload = true, p }))
+	require.NoError(t, err)
+	l.partSize = 1024
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.Write([]byte(strings.Repeat("y", 99)+"\n")))
+	}
+	err = l.Close(context.Background())
+	assert.ErrorContains(t, err, "connection reset")
+	assert.True(t, client.aborted)
+	assert.True(t, called)
+	assert.Nil(t, payload)
+	assert.Empty(t, client.objects)
+}
+
+func TestMultipartSmallChunkUsesPutObject(t *testing.T) {
+	client := &multipartMockClient{s3MockClient: s3MockClient{debugChan: make(chan interface{}, 1)}}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithMultipartUpload(MinPartSize))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("small\n")))
+	l.Sync()
+
+	assert.Len(t, client.debugChan, 1)
+	assert.Empty(t, client.objects)
+}
+
+func TestMultipartOptionValidation(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithMultipartUpload(1024))
+	assert.Error(t, err)
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithMultipartUpload(MinPartSize), WithSpoolDir(t.TempDir()))
+	assert.Error(t, err)
+}
@@ -0,0 +1,135 @@
+package s3logger
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Metadata keys set on every uploaded object.
+const (
+	MetadataService     = "service"
+	MetadataRecordCount = "record-count"
+	MetadataFirstRecord = "first-record"
+	MetadataLastRecord  = "last-record"
+)
+
+// WithServerSideEncryption encrypts the uploaded objects at rest. Pass
+// types.ServerSideEncryptionAes256 for SSE-S3 or types.ServerSideEncryptionAwsKms
+// with an optional key id for SSE-KMS.
+func WithServerSideEncryption(sse types.ServerSideEncryption, kmsKeyID string) Option {
+	return func(l *S3Logger) error {
+		if kmsKeyID != "" && sse != types.ServerSideEncryptionAwsKms && sse != types.ServerSideEncryptionAwsKmsDsse {
+			return errors.New("kms key id requires kms server-side encryption")
+		}
+		l.sse = sse
+		l.sseKMSKeyID = kmsKeyID
+		return nil
+	}
+}
+
+// WithStorageClass sets the storage class of the uploaded objects.
+func WithStorageClass(class types.StorageClass) Option {
+	return func(l *S3Logger) error {
+		l.storageClass = class
+		return nil
+	}
+}
+
+// WithObjectTags tags the uploaded objects.
+func WithObjectTags(tags map[string]string) Option {
+	return func(l *S3Logger) error {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := url.Values{}
+		for _, k := range keys {
+			values.Set(k, tags[k])
+		}
+		l.tagging = values.Encode()
+		return nil
+	}
+}
+
+// WithMetadata adds custom metadata to the uploaded objects. The service name,
+// record count and the timestamps of the first and last record are always set.
+func WithMetadata(metadata map[string]string) Option {
+	return func(l *S3Logger) error {
+		l.metadata = make(map[string]string, len(metadata))
+		for k, v := range metadata {
+			l.metadata[k] = v
+		}
+		return nil
+	}
+}
+
+// extension returns the extension of the uploaded objects.
+func (l *S3Logger) extension() string {
+	if l.keyWrapper != nil {
+		return l.codec.Extension() + EncryptedExtension
+	}
+	return l.codec.Extension()
+}
+
+// objectMetadata returns the metadata of an object holding the given records.
+func (l *S3Logger) objectMetadata(info chunkInfo) map[string]string {
+	metadata := make(map[string]string, len(l.metadata)+4)
+	for k, v := range l.metadata {
+		metadata[k] = v
+	}
+	if l.serviceName != "" {
+		metadata[MetadataService] = l.serviceName
+	}
+	if info.Records > 0 {
+		metadata[MetadataRecordCount] = strconv.FormatUint(uint64(info.Records), 10)
+		metadata[MetadataFirstRecord] = info.First.UTC().Format(time.RFC3339Nano)
+		metadata[MetadataLastRecord] = info.Last.UTC().Format(time.RFC3339Nano)
+	}
+	return metadata
+}
+
+// checksums returns the base64 encoded SHA-256 and MD5 digests of data as
+// expected by S3.
+func checksums(data []byte) (string, string) {
+	sha256Sum := sha256.Sum256(data)
+	md5Sum := md5.Sum(data)
+	return base64.StdEncoding.EncodeToString(sha256Sum[:]), base64.StdEncoding.EncodeToString(md5Sum[:])
+}
+
+// createMultipartUploadInput builds the request starting a multipart upload.
+// The record count and the last record are unknown at that point, so only
+// the time of the first record is set.
+func (l *S3Logger) createMultipartUploadInput(key string, first time.Time) *s3.CreateMultipartUploadInput {
+	metadata := l.objectMetadata(chunkInfo{})
+	metadata[MetadataFirstRecord] = first.UTC().Format(time.RFC3339Nano)
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(l.bucket),
+		Key:                  aws.String(key),
+		ContentType:          aws.String(l.codec.ContentType()),
+		ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+		Metadata:             metadata,
+		ServerSideEncryption: l.sse,
+		StorageClass:         l.storageClass,
+	}
+	if enc := l.codec.ContentEncoding(); enc != "" {
+		input.ContentEncoding = aws.String(enc)
+	}
+	if l.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(l.sseKMSKeyID)
+	}
+	if l.tagging != "" {
+		input.Tagging = aws.String(l.tagging)
+	}
+	return input
+}
@@ -0,0 +1,102 @@
+package s3logger
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjectOptions(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(),
+		WithService("curation"),
+		WithServerSideEncryption(types.ServerSideEncryptionAwsKms, "alias/logs"),
+		WithStorageClass(types.StorageClassStandardIa),
+		WithObjectTags(map[string]string{"team": "curation", "env": "prod test"}),
+		WithMetadata(map[string]string{"owner": "foundry"}),
+	)
+	require.NoError(t, err)
+
+	before := time.Now()
+	require.NoError(t, l.Write([]byte("first\n")))
+	require.NoError(t, l.Write([]byte("second\n")))
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	body, err := io.ReadAll(rs.Body)
+	require.NoError(t, err)
+	sha256Sum := sha256.Sum256(body)
+	md5Sum := md5.Sum(body)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(sha256Sum[:]), *rs.ChecksumSHA256)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(md5Sum[:]), *rs.ContentMD5)
+	assert.Equal(t, int64(len(body)), *rs.ContentLength)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, rs.ServerSideEncryption)
+	assert.Equal(t, "alias/logs", *rs.SSEKMSKeyId)
+	assert.Equal(t, types.StorageClassStandardIa, rs.StorageClass)
+	assert.Equal(t, "env=prod+test&team=curation", *rs.Tagging)
+	assert.Equal(t, "foundry", rs.Metadata["owner"])
+	assert.Equal(t, "curation", rs.Metadata[MetadataService])
+	assert.Equal(t, "2", rs.Metadata[MetadataRecordCount])
+
+	first, err := time.Parse(time.RFC3339Nano, rs.Metadata[MetadataFirstRecord])
+	require.NoError(t, err)
+	last, err := time.Parse(time.RFC3339Nano, rs.Metadata[MetadataLastRecord])
+	require.NoError(t, err)
+	assert.WithinDuration(t, before, first, time.Second)
+	assert.False(t, last.Before(first))
+}
+
+func TestInvalidServerSideEncryption(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(),
+		WithServerSideEncryption(types.ServerSideEncryptionAes256, "alias/logs"))
+	assert.Error(t, err)
+}
+
+func TestSpooledObjectKeepsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Write([]byte("record\n")))
+	}
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "3", rs.Metadata[MetadataRecordCount])
+	assert.NotEmpty(t, rs.Metadata[MetadataFirstRecord])
+
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(dir)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSpooledObjectWithoutInfo(t *testing.T) {
+	dir := t.TempDir()
+	key := "logs/2024/01/01/00/spooled.gz"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, url.PathEscape(key)), []byte("record\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "orphan"+spoolInfoSuffix), []byte("{}"), 0o600))
+
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	_, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, key, *rs.Key)
+	assert.NotContains(t, rs.Metadata, MetadataRecordCount)
+	assert.NoFileExists(t, filepath.Join(dir, "orphan"+spoolInfoSuffix))
+}
@@ -0,0 +1,128 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// UploadOperation is the S3 request of an upload attempt.
+type UploadOperation string
+
+const (
+	OperationPutObject         UploadOperation = "PutObject"
+	OperationCreateMultipart   UploadOperation = "CreateMultipartUpload"
+	OperationUploadPart        UploadOperation = "UploadPart"
+	OperationCompleteMultipart UploadOperation = "CompleteMultipartUpload"
+	OperationPutManifest       UploadOperation = "PutManifest"
+	// OperationSinkPut is a call of Sink.Put.
+	OperationSinkPut UploadOperation = "SinkPut"
+)
+
+// DropReason tells why records were discarded.
+type DropReason string
+
+const (
+	// DropOverflow is reported for records dropped by the overflow policy.
+	DropOverflow DropReason = "overflow"
+	// DropSampled is reported for records dropped by sampling.
+	DropSampled DropReason = "sampled"
+	// DropRateLimited is reported for records dropped by the sampling rate.
+	DropRateLimited DropReason = "rate_limited"
+	// DropUploadFailed is reported for chunks that could not be uploaded
+	// and were handed to the UploadErrorHandler.
+	DropUploadFailed DropReason = "upload_failed"
+)
+
+// UploadEvent describes an upload attempt. Latency and Err are only set for
+// results.
+type UploadEvent struct {
+	Operation UploadOperation
+	Key       string
+	// Attempt counts from 1 for every retry of the same request.
+	Attempt int
+	Bytes   int
+	Latency time.Duration
+	Err     error
+}
+
+// ChunkEvent describes a chunk cut for upload.
+type ChunkEvent struct {
+	Records           uint
+	UncompressedBytes uint
+	Bytes             int
+}
+
+// DropEvent describes discarded records.
+type DropEvent struct {
+	Reason  DropReason
+	Records uint64
+}
+
+// Observer is notified about the work of an S3Logger. The methods are called
+// synchronously on the logging and upload paths, but never with the logger
+// locked. They should be fast.
+type Observer interface {
+	UploadAttempt(e UploadEvent)
+	UploadResult(e UploadEvent)
+	ChunkCut(e ChunkEvent)
+	Dropped(e DropEvent)
+}
+
+// NopObserver ignores all events. Embed it to implement only some methods.
+type NopObserver struct{}
+
+func (NopObserver) UploadAttempt(UploadEvent) {}
+func (NopObserver) UploadResult(UploadEvent)  {}
+func (NopObserver) ChunkCut(ChunkEvent)       {}
+func (NopObserver) Dropped(DropEvent)         {}
+
+// WithObserver reports the work of the logger to o.
+func WithObserver(o Observer) Option {
+	return func(l *S3Logger) error {
+		if o == nil {
+			return errors.New("observer must not be nil")
+		}
+		l.observer = o
+		return nil
+	}
+}
+
+// notify queues an observer callback. It must be called with l.mutex held,
+// the callback runs once the mutex is released by unlock.
+func (l *S3Logger) notify(fn func(o Observer)) {
+	l.events = append(l.events, fn)
+}
+
+// unlock releases l.mutex and runs the observer callbacks queued while it was
+// held.
+func (l *S3Logger) unlock() {
+	events := l.events
+	l.events = nil
+	l.mutex.Unlock()
+	for _, fn := range events {
+		fn(l.observer)
+	}
+}
+
+// observed wraps fn, which is retried by the retry policy, with the upload
+// callbacks of the observer and bounds every attempt by the upload timeout.
+func (l *S3Logger) observed(op UploadOperation, key string, size int, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	attempt := 0
+	return func(ctx context.Context) error {
+		attempt++
+		e := UploadEvent{Operation: op, Key: key, Attempt: attempt, Bytes: size}
+		l.observer.UploadAttempt(e)
+		if l.uploadTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, l.uploadTimeout)
+			defer cancel()
+		}
+		start := time.Now()
+		err := fn(ctx)
+		e.Latency = time.Since(start)
+		e.Err = err
+		l.observer.UploadResult(e)
+		return err
+	}
+}
@@ -0,0 +1,139 @@
+package s3logger
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	mutex    sync.Mutex
+	attempts []UploadEvent
+	results  []UploadEvent
+	chunks   []ChunkEvent
+	drops    []DropEvent
+}
+
+func (o *recordingObserver) UploadAttempt(e UploadEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.attempts = append(o.attempts, e)
+}
+
+func (o *recordingObserver) UploadResult(e UploadEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.results = append(o.results, e)
+}
+
+func (o *recordingObserver) ChunkCut(e ChunkEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.chunks = append(o.chunks, e)
+}
+
+func (o *recordingObserver) Dropped(e DropEvent) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.drops = append(o.drops, e)
+}
+
+func TestObserverUploads(t *testing.T) {
+	client := &flakyS3Client{failures: 1}
+	o := &recordingObserver{}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithRetryPolicy(fastRetries), WithObserver(o))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("one\n")))
+	require.NoError(t, l.Write([]byte("two\n")))
+	l.Sync()
+
+	require.Len(t, o.chunks, 1)
+	assert.Equal(t, uint(2), o.chunks[0].Records)
+	assert.Equal(t, uint(8), o.chunks[0].UncompressedBytes)
+	assert.Positive(t, o.chunks[0].Bytes)
+
+	require.Len(t, o.attempts, 2)
+	require.Len(t, o.results, 2)
+	for i, e := range o.results {
+		assert.Equal(t, OperationPutObject, e.Operation)
+		assert.Equal(t, i+1, e.Attempt)
+		assert.Equal(t, o.chunks[0].Bytes, e.Bytes)
+		assert.Equal(t, o.attempts[i].Key, e.Key)
+		assert.Positive(t, e.Latency)
+	}
+	assert.Error(t, o.results[0].Err)
+	assert.NoError(t, o.results[1].Err)
+	assert.Empty(t, o.drops)
+}
+
+func TestObserverDrops(t *testing.T) {
+	o := &recordingObserver{}
+	l, err := New("foundry-curation-test", &flakyS3Client{failures: 10}, WithoutBatchFrequency(), WithObserver(o),
+		WithOnUploadError(func(string, []byte, error) {}),
+		WithSampling(SamplingPolicy{Tick: time.Hour, First: 2}))
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Write([]byte("noisy\n")))
+	}
+	l.Sync()
+
+	assert.Equal(t, []DropEvent{
+		{Reason: DropSampled, Records: 1},
+		{Reason: DropSampled, Records: 1},
+		{Reason: DropSampled, Records: 1},
+		{Reason: DropUploadFailed, Records: 2},
+	}, o.drops)
+}
+
+// statsObserver reads the stats of the logger in every callback, which
+// deadlocks if a callback runs with the logger locked.
+type statsObserver struct {
+	NopObserver
+	l      *S3Logger
+	chunks int
+	drops  int
+}
+
+func (o *statsObserver) ChunkCut(ChunkEvent) {
+	_ = o.l.Stats()
+	o.chunks++
+}
+
+func (o *statsObserver) Dropped(DropEvent) {
+	_ = o.l.Stats()
+	o.drops++
+}
+
+func TestObserverRunsUnlocked(t *testing.T) {
+	o := &statsObserver{}
+	l, client := newGatedLogger(t, OverflowDropNewest, WithMaxRecords(1), WithObserver(o))
+	o.l = l
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, l.Write(record(i)))
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("observer called with the logger locked")
+	}
+	close(client.gate)
+	require.NoError(t, l.Close(context.Background()))
+	assert.Equal(t, 2, o.chunks)
+	assert.Equal(t, 2, o.drops)
+}
+
+func TestObserverOption(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithObserver(nil))
+	assert.Error(t, err)
+}
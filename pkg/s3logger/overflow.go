@@ -0,0 +1,174 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// OverflowPolicy decides what a write does when WithMaxInFlightBytes is
+// exceeded.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the writer until uploads free enough memory.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest discards the record being written.
+	OverflowDropNewest
+	// OverflowDropOldest discards the oldest chunks that are not uploading yet.
+	OverflowDropOldest
+	// OverflowSpillToDisk writes the current chunk to the spool dir instead of
+	// keeping it in memory. It requires WithSpoolDir.
+	OverflowSpillToDisk
+)
+
+// Stats is a snapshot of the logger's memory use and losses.
+type Stats struct {
+	BufferedBytes  uint
+	InFlightBytes  uint
+	QueuedChunks   int
+	DroppedRecords uint64
+	DroppedChunks  uint64
+	// SampledRecords and RateLimitedRecords are suppressed by WithSampling.
+	SampledRecords     uint64
+	RateLimitedRecords uint64
+}
+
+// WithMaxInFlightBytes bounds the compressed bytes held in memory by the
+// current chunk and all chunks waiting for or in upload. Zero disables the
+// bound. If the current chunk alone reaches n, it is rotated and neither
+// dropped nor counted until it is uploaded, so n may be below the maximum
+// file size and memory may reach n plus one chunk.
+func WithMaxInFlightBytes(n uint) Option {
+	return func(l *S3Logger) error {
+		l.maxInFlightBytes = n
+		return nil
+	}
+}
+
+func WithOverflowPolicy(p OverflowPolicy) Option {
+	return func(l *S3Logger) error {
+		if p < OverflowBlock || p > OverflowSpillToDisk {
+			return errors.New("unknown overflow policy")
+		}
+		l.overflowPolicy = p
+		return nil
+	}
+}
+
+// Stats returns the current memory use and the number of dropped and
+// suppressed records.
+func (l *S3Logger) Stats() Stats {
+	var stats Stats
+	if l.sampler != nil {
+		stats.SampledRecords, stats.RateLimitedRecords = l.sampler.Suppressed()
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	stats.BufferedBytes = l.compressedSize()
+	stats.InFlightBytes = l.inFlightBytes
+	stats.QueuedChunks = len(l.queue)
+	stats.DroppedRecords = l.droppedRecords
+	stats.DroppedChunks = l.droppedChunks
+	return stats
+}
+
+func (l *S3Logger) overLimit() bool {
+	return l.maxInFlightBytes > 0 && l.inFlightBytes-l.protectedBytes+uint(l.buffer.Len()) >= l.maxInFlightBytes
+}
+
+// rotateAlone rotates the current chunk, which alone reached the limit and
+// would never grow to the rotation size otherwise. The chunk is never
+// dropped and does not count towards the limit until it is uploaded or the
+// next chunk is rotated alone. It must be called with l.mutex held.
+func (l *S3Logger) rotateAlone() {
+	l.rotate()
+	c := l.queue[len(l.queue)-1]
+	c.protected = true
+	l.protectedSeq, l.protectedBytes = c.seq, c.size()
+}
+
+// admit applies the overflow policy before a record is written. It must be
+// called with l.mutex held and returns false if the record is to be dropped.
+// Without wait, OverflowBlock drops the record like OverflowDropNewest.
+func (l *S3Logger) admit(ctx context.Context, wait bool) (bool, error) {
+	for l.overLimit() {
+		if l.overflowPolicy != OverflowSpillToDisk && l.inFlightBytes == l.protectedBytes && l.records > 0 {
+			l.rotateAlone()
+			continue
+		}
+		switch {
+		case l.overflowPolicy == OverflowDropNewest, l.overflowPolicy == OverflowBlock && !wait:
+			l.droppedRecords++
+			l.notify(func(o Observer) { o.Dropped(DropEvent{Reason: DropOverflow, Records: 1}) })
+			return false, nil
+		case l.overflowPolicy == OverflowDropOldest:
+			if i := l.droppable(); i >= 0 {
+				c := l.queue[i]
+				l.queue = slices.Delete(l.queue, i, i+1)
+				l.inFlightBytes -= c.size()
+				l.dropChunk(c)
+				continue
+			}
+			if c := l.cut(); c != nil {
+				l.dropChunk(c)
+			}
+			return true, nil
+		case l.overflowPolicy == OverflowSpillToDisk:
+			c := l.cut()
+			if c == nil {
+				return true, nil
+			}
+			err := l.spoolChunk(c)
+			if err != nil {
+				// keep the chunk rather than losing it
+				l.enqueue(c)
+				return true, nil
+			}
+		default:
+			l.waitContext(ctx)
+			if l.closed.Load() {
+				return false, ErrClosed
+			}
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// droppable returns the index of the oldest queued chunk that is not
+// protected, or -1. It must be called with l.mutex held.
+func (l *S3Logger) droppable() int {
+	return slices.IndexFunc(l.queue, func(c *chunk) bool { return !c.protected })
+}
+
+func (l *S3Logger) dropChunk(c *chunk) {
+	l.droppedRecords += uint64(c.info.Records)
+	l.droppedChunks++
+	records := uint64(c.info.Records)
+	l.notify(func(o Observer) { o.Dropped(DropEvent{Reason: DropOverflow, Records: records}) })
+	if c.lastPart != nil {
+		// the upload is streaming already, its runner aborts it
+		c.lastPart.mp.cancel()
+		c.lastPart.data = nil
+		go c.lastPart.finish()
+	}
+}
+
+// waitContext waits for l.cond like l.cond.Wait, but also wakes up once ctx
+// is done. It must be called with l.mutex held.
+func (l *S3Logger) waitContext(ctx context.Context) {
+	if ctx.Done() == nil {
+		l.cond.Wait()
+		return
+	}
+	stop := context.AfterFunc(ctx, func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.cond.Broadcast()
+	})
+	l.cond.Wait()
+	stop()
+}
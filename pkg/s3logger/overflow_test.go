@@ -0,0 +1,236 @@
+package s3logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gatedS3Client struct {
+	s3MockClient
+	gate   chan struct{}
+	mutex  sync.Mutex
+	bodies []string
+}
+
+func (c *gatedS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	select {
+	case <-c.gate:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.bodies = append(c.bodies, string(data))
+	return &s3.PutObjectOutput{}, nil
+}
+
+func newGatedLogger(t *testing.T, policy OverflowPolicy, opts ...Option) (*S3Logger, *gatedS3Client) {
+	client := &gatedS3Client{gate: make(chan struct{})}
+	opts = append([]Option{WithoutBatchFrequency(), WithCodec(NoneCodec{}), WithUploadConcurrency(1),
+		WithMaxInFlightBytes(100), WithOverflowPolicy(policy)}, opts...)
+	l, err := New("foundry-curation-test", client, opts...)
+	require.NoError(t, err)
+	return l, client
+}
+
+func record(n int) []byte {
+	return []byte(strings.Repeat(string(rune('a'+n)), 49) + "\n")
+}
+
+func TestOverflowDropNewest(t *testing.T) {
+	l, client := newGatedLogger(t, OverflowDropNewest, WithMaxRecords(1))
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, l.Write(record(i)))
+	}
+	assert.Equal(t, uint64(2), l.Stats().DroppedRecords)
+	assert.Equal(t, uint(100), l.Stats().InFlightBytes)
+
+	close(client.gate)
+	require.NoError(t, l.Close(context.Background()))
+	assert.ElementsMatch(t, []string{string(record(0)), string(record(1))}, client.bodies)
+}
+
+func TestOverflowRotatesChunkOverLimit(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowDropOldest} {
+		l, client := newGatedLogger(t, policy)
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, l.Write(record(i)))
+		}
+		close(client.gate)
+		assert.Eventually(t, func() bool { return l.Stats().InFlightBytes == 0 }, time.Second, time.Millisecond)
+		require.NoError(t, l.Write(record(3)))
+		require.NoError(t, l.Close(context.Background()))
+
+		// the chunk rotated over the limit and the record crossing it are kept
+		assert.Equal(t, []string{string(record(0)) + string(record(1)), string(record(2)) + string(record(3))}, client.bodies)
+		assert.Zero(t, l.Stats().DroppedRecords)
+		assert.Zero(t, l.Stats().DroppedChunks)
+	}
+}
+
+func TestOverflowDeliversChunksOverLimit(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowDropNewest, OverflowDropOldest} {
+		sink := &memorySink{}
+		l, err := NewWithSink(sink, WithoutBatchFrequency(), WithMaxInFlightBytes(1000), WithOverflowPolicy(policy))
+		require.NoError(t, err)
+
+		for i := 0; i < 10000; i++ {
+			require.NoError(t, l.WriteRecord([]byte(fmt.Sprintf("record %d", i))))
+			// let the uploads keep up like with a fast sink
+			require.Eventually(t, func() bool { return l.Stats().QueuedChunks == 0 }, time.Second, 10*time.Microsecond)
+		}
+		require.NoError(t, l.Close(context.Background()))
+
+		records := 0
+		for _, o := range sink.objects {
+			r, err := gzip.NewReader(bytes.NewReader(o.Data))
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			records += bytes.Count(data, []byte("\n"))
+		}
+		assert.Equal(t, 10000, records, policy)
+		assert.Greater(t, len(sink.objects), 1, policy)
+		assert.Zero(t, l.Stats().DroppedRecords, policy)
+		assert.Zero(t, l.Stats().DroppedChunks, policy)
+	}
+}
+
+func TestOverflowKeepsProtectedChunks(t *testing.T) {
+	l, client := newGatedLogger(t, OverflowDropOldest)
+
+	// r0 and r1 reach the limit alone, then r2 and r3 do too
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Write(record(i)))
+	}
+	assert.Zero(t, l.Stats().DroppedChunks)
+
+	close(client.gate)
+	require.NoError(t, l.Close(context.Background()))
+	assert.Equal(t, []string{string(record(0)) + string(record(1)), string(record(2)) + string(record(3)), string(record(4))}, client.bodies)
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	l, client := newGatedLogger(t, OverflowDropOldest, WithMaxRecords(1))
+
+	require.NoError(t, l.Write(record(0)))
+	assert.Eventually(t, func() bool { return l.Stats().QueuedChunks == 0 }, time.Second, time.Millisecond)
+	for i := 1; i < 4; i++ {
+		require.NoError(t, l.Write(record(i)))
+	}
+	stats := l.Stats()
+	assert.Equal(t, uint64(2), stats.DroppedRecords)
+	assert.Equal(t, uint64(2), stats.DroppedChunks)
+
+	close(client.gate)
+	require.NoError(t, l.Close(context.Background()))
+	assert.ElementsMatch(t, []string{string(record(0)), string(record(3))}, client.bodies)
+}
+
+func TestOverflowBlock(t *testing.T) {
+	l, client := newGatedLogger(t, OverflowBlock, WithMaxRecords(1))
+
+	require.NoError(t, l.Write(record(0)))
+	require.NoError(t, l.Write(record(1)))
+
+	written := make(chan error)
+	go func() { written <- l.Write(record(2)) }()
+	select {
+	case <-written:
+		t.Fatal("write did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(client.gate)
+	require.NoError(t, <-written)
+	require.NoError(t, l.Close(context.Background()))
+	assert.Len(t, client.bodies, 3)
+	assert.Zero(t, l.Stats().DroppedRecords)
+}
+
+func TestOverflowBlockWriteContext(t *testing.T) {
+	l, client := newGatedLogger(t, OverflowBlock, WithMaxRecords(1))
+	defer close(client.gate)
+
+	require.NoError(t, l.Write(record(0)))
+	require.NoError(t, l.Write(record(1)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.WriteContext(ctx, record(2)), context.DeadlineExceeded)
+	assert.ErrorIs(t, l.WriteContext(ctx, record(3)), context.DeadlineExceeded)
+	assert.Zero(t, l.Stats().DroppedRecords)
+}
+
+func TestOverflowBlockDropsSamplingSummary(t *testing.T) {
+	l, client := newGatedLogger(t, OverflowBlock, WithMaxRecords(1), WithSampling(SamplingPolicy{
+		Tick:            time.Hour,
+		First:           1,
+		SummaryInterval: time.Hour,
+		Key:             func(record []byte) string { return string(record) },
+	}))
+
+	for _, i := range []int{0, 1, 0} {
+		require.NoError(t, l.Write(record(i)))
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.writeSamplingSummary(time.Now().Add(2 * time.Hour))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sampling summary blocked")
+	}
+	assert.Equal(t, uint64(1), l.Stats().DroppedRecords)
+
+	close(client.gate)
+	require.NoError(t, l.Close(context.Background()))
+	assert.ElementsMatch(t, []string{string(record(0)), string(record(1))}, client.bodies)
+}
+
+func TestOverflowSpillToDisk(t *testing.T) {
+	dir := t.TempDir()
+	l, client := newGatedLogger(t, OverflowSpillToDisk, WithSpoolDir(dir))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.Write(record(i)))
+	}
+	stats := l.Stats()
+	assert.Less(t, stats.BufferedBytes, uint(100))
+	assert.Zero(t, stats.DroppedRecords)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.NotEmpty(t, entries)
+
+	close(client.gate)
+	require.NoError(t, l.Close(context.Background()))
+	assert.Equal(t, 5*50, len(strings.Join(client.bodies, "")))
+}
+
+func TestOverflowValidation(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithOverflowPolicy(OverflowSpillToDisk))
+	assert.Error(t, err)
+	_, err = New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithOverflowPolicy(OverflowPolicy(42)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,366 @@
+package s3logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// ErrInvalidParquetRecord is returned for records written with ParquetCodec
+// that are not JSON objects.
+var ErrInvalidParquetRecord = errors.New("s3logger: parquet record is not a JSON object")
+
+// ParquetType is the type of a Parquet column.
+type ParquetType int
+
+const (
+	ParquetString ParquetType = iota
+	ParquetInt64
+	ParquetDouble
+	ParquetBool
+	// ParquetTimestamp stores RFC 3339 strings or unix seconds with
+	// millisecond precision.
+	ParquetTimestamp
+)
+
+// ParquetColumn declares a column of a Parquet file.
+type ParquetColumn struct {
+	Name string
+	// Path is the dotted path of the field in the record, it defaults to Name.
+	Path string
+	Type ParquetType
+}
+
+// ParquetCodec writes every chunk as one Parquet file. Records must be JSON
+// objects like the ones of WriteJSON or NewSlogHandler.
+//
+// Without Columns the schema is inferred from the top-level fields of each
+// chunk, so the files of a logger may differ in their columns: numbers become
+// int64 or double columns, booleans bool columns and strings timestamp columns
+// if all of them are RFC 3339 timestamps. Objects, arrays and fields of mixed
+// types are stored as JSON strings. With Columns, other fields are dropped and
+// values not matching the column type are null.
+//
+// The file is written when the chunk is cut, so WithMaxFileSize limits the
+// uncompressed size of the chunk and multipart uploads are not supported.
+type ParquetCodec struct {
+	Columns []ParquetColumn
+	// Compression of the column chunks, it defaults to snappy.
+	Compression compress.Codec
+
+	// delimiter separates the records, it defaults to a newline.
+	delimiter []byte
+}
+
+// forLogger returns the codec with the record delimiter of a logger.
+func (c ParquetCodec) forLogger(delimiter []byte) ParquetCodec {
+	c.delimiter = delimiter
+	return c
+}
+
+func (c ParquetCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	names := map[string]bool{}
+	for _, col := range c.Columns {
+		switch {
+		case col.Name == "":
+			return nil, errors.New("parquet column name must not be empty")
+		case names[col.Name]:
+			return nil, fmt.Errorf("duplicate parquet column %s", col.Name)
+		case col.Type < ParquetString || col.Type > ParquetTimestamp:
+			return nil, fmt.Errorf("invalid type of parquet column %s", col.Name)
+		}
+		names[col.Name] = true
+	}
+	return &parquetWriter{w: w, codec: c}, nil
+}
+
+// NewReader converts a Parquet file back to JSON records terminated by the
+// record delimiter of the logger, a newline by default.
+func (c ParquetCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	fields := f.Schema().Fields()
+	rows := make([]parquet.Row, 64)
+	for _, rg := range f.RowGroups() {
+		err = readParquetRows(rg.Rows(), fields, rows, c.recordDelimiter(), &out)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return io.NopCloser(&out), nil
+}
+
+func (c ParquetCodec) recordDelimiter() []byte {
+	if len(c.delimiter) == 0 {
+		return []byte("\n")
+	}
+	return c.delimiter
+}
+
+func (c ParquetCodec) Extension() string       { return ".parquet" }
+func (c ParquetCodec) ContentEncoding() string { return "" }
+func (c ParquetCodec) ContentType() string     { return "application/vnd.apache.parquet" }
+
+// parquetWriter collects the records of a chunk and writes them as Parquet
+// file on Close.
+type parquetWriter struct {
+	w       io.Writer
+	codec   ParquetCodec
+	records []map[string]any
+}
+
+func (p *parquetWriter) Write(b []byte) (int, error) {
+	var records []map[string]any
+	for line := range bytes.SplitSeq(b, p.codec.recordDelimiter()) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record map[string]any
+		d := json.NewDecoder(bytes.NewReader(line))
+		d.UseNumber()
+		if d.Decode(&record) != nil || record == nil || d.More() {
+			return 0, ErrInvalidParquetRecord
+		}
+		records = append(records, record)
+	}
+	p.records = append(p.records, records...)
+	return len(b), nil
+}
+
+func (p *parquetWriter) Close() error {
+	if len(p.records) == 0 {
+		return nil
+	}
+	columns := p.codec.Columns
+	if len(columns) == 0 {
+		columns = inferParquetColumns(p.records)
+	}
+	group := parquet.Group{}
+	types := map[string]ParquetType{}
+	paths := map[string][]string{}
+	for _, c := range columns {
+		group[c.Name] = parquet.Optional(c.Type.node())
+		types[c.Name] = c.Type
+		path := c.Path
+		if path == "" {
+			path = c.Name
+		}
+		paths[c.Name] = strings.Split(path, ".")
+	}
+	schema := parquet.NewSchema("record", group)
+	compression := p.codec.Compression
+	if compression == nil {
+		compression = &parquet.Snappy
+	}
+	w := parquet.NewWriter(p.w, schema, parquet.Compression(compression))
+	fields := schema.Fields()
+	rows := make([]parquet.Row, 0, len(p.records))
+	for _, record := range p.records {
+		row := make(parquet.Row, len(fields))
+		for i, f := range fields {
+			v, ok := types[f.Name()].value(lookupPath(record, paths[f.Name()]))
+			if ok {
+				row[i] = v.Level(0, 1, i)
+			} else {
+				row[i] = parquet.NullValue().Level(0, 0, i)
+			}
+		}
+		rows = append(rows, row)
+	}
+	p.records = nil
+	_, err := w.WriteRows(rows)
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (t ParquetType) node() parquet.Node {
+	switch t {
+	case ParquetInt64:
+		return parquet.Int(64)
+	case ParquetDouble:
+		return parquet.Leaf(parquet.DoubleType)
+	case ParquetBool:
+		return parquet.Leaf(parquet.BooleanType)
+	case ParquetTimestamp:
+		return parquet.Timestamp(parquet.Millisecond)
+	}
+	return parquet.String()
+}
+
+// value converts a JSON value to the column type.
+func (t ParquetType) value(v any) (parquet.Value, bool) {
+	switch t {
+	case ParquetInt64:
+		if n, ok := v.(json.Number); ok {
+			i, err := n.Int64()
+			return parquet.Int64Value(i), err == nil
+		}
+	case ParquetDouble:
+		if n, ok := v.(json.Number); ok {
+			f, err := n.Float64()
+			return parquet.DoubleValue(f), err == nil
+		}
+	case ParquetBool:
+		if b, ok := v.(bool); ok {
+			return parquet.BooleanValue(b), true
+		}
+	case ParquetTimestamp:
+		switch v := v.(type) {
+		case string:
+			ts, err := time.Parse(time.RFC3339Nano, v)
+			return parquet.Int64Value(ts.UnixMilli()), err == nil
+		case json.Number:
+			f, err := v.Float64()
+			return parquet.Int64Value(int64(f * 1000)), err == nil
+		}
+	default:
+		switch v := v.(type) {
+		case nil:
+		case string:
+			return parquet.ByteArrayValue([]byte(v)), true
+		default:
+			data, err := json.Marshal(v)
+			return parquet.ByteArrayValue(data), err == nil
+		}
+	}
+	return parquet.Value{}, false
+}
+
+// inferParquetColumns returns a column for every top-level field of the
+// records.
+func inferParquetColumns(records []map[string]any) []ParquetColumn {
+	types := map[string]ParquetType{}
+	for _, record := range records {
+		for name, v := range record {
+			t, ok := inferParquetType(v)
+			if !ok {
+				continue
+			}
+			if prev, seen := types[name]; seen && prev != t {
+				switch {
+				case prev == ParquetInt64 && t == ParquetDouble, prev == ParquetDouble && t == ParquetInt64:
+					t = ParquetDouble
+				default:
+					t = ParquetString
+				}
+			}
+			types[name] = t
+		}
+	}
+	for _, record := range records {
+		for name := range record {
+			if _, ok := types[name]; !ok {
+				types[name] = ParquetString
+			}
+		}
+	}
+	columns := make([]ParquetColumn, 0, len(types))
+	for name, t := range types {
+		columns = append(columns, ParquetColumn{Name: name, Type: t})
+	}
+	return columns
+}
+
+// inferParquetType returns the column type for a JSON value, false for null.
+func inferParquetType(v any) (ParquetType, bool) {
+	switch v := v.(type) {
+	case nil:
+		return 0, false
+	case bool:
+		return ParquetBool, true
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return ParquetInt64, true
+		}
+		return ParquetDouble, true
+	case string:
+		if _, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return ParquetTimestamp, true
+		}
+	}
+	return ParquetString, true
+}
+
+func lookupPath(record map[string]any, path []string) any {
+	var v any = record
+	for _, name := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// readParquetRows writes the rows as JSON records to out.
+func readParquetRows(r parquet.Rows, fields []parquet.Field, rows []parquet.Row, delimiter []byte, out *bytes.Buffer) error {
+	defer r.Close()
+	for {
+		n, err := r.ReadRows(rows)
+		for _, row := range rows[:n] {
+			record := make(map[string]any, len(row))
+			for _, v := range row {
+				if v.IsNull() || v.Column() >= len(fields) {
+					continue
+				}
+				f := fields[v.Column()]
+				record[f.Name()] = parquetJSONValue(f.Type(), v)
+			}
+			data, jsonErr := json.Marshal(record)
+			if jsonErr != nil {
+				return jsonErr
+			}
+			out.Write(data)
+			out.Write(delimiter)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read parquet rows: %w", err)
+		}
+	}
+}
+
+func parquetJSONValue(t parquet.Type, v parquet.Value) any {
+	switch v.Kind() {
+	case parquet.Boolean:
+		return v.Boolean()
+	case parquet.Int32:
+		return v.Int32()
+	case parquet.Int64:
+		if lt := t.LogicalType(); lt != nil && lt.Timestamp != nil {
+			return time.UnixMilli(v.Int64()).UTC().Format(time.RFC3339Nano)
+		}
+		return v.Int64()
+	case parquet.Float:
+		return v.Float()
+	case parquet.Double:
+		return v.Double()
+	}
+	return string(v.ByteArray())
+}
+
+// isParquet reports whether the codec writes Parquet files, which are only
+// written when the chunk is cut.
+func isParquet(c Codec) bool {
+	_, ok := c.(ParquetCodec)
+	return ok
+}
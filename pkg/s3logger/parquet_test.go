@@ -0,0 +1,136 @@
+package s3logger
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/parquet-go/parquet-go"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParquetCodec(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(ParquetCodec{}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.WriteJSON(map[string]any{"time": "2024-03-01T10:00:00.123Z", "msg": "first", "status": 200, "ok": true}))
+	require.NoError(t, l.WriteJSON(map[string]any{"time": "2024-03-01T10:00:01Z", "msg": "second", "status": 200.5, "http": map[string]any{"path": "/"}}))
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.True(t, strings.HasSuffix(*rs.Key, ".parquet"), *rs.Key)
+	assert.Nil(t, rs.ContentEncoding)
+	assert.Equal(t, "application/vnd.apache.parquet", *rs.ContentType)
+
+	data, err := io.ReadAll(rs.Body)
+	require.NoError(t, err)
+	f, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, f.NumRows())
+	types := map[string]string{}
+	for _, field := range f.Schema().Fields() {
+		assert.True(t, field.Optional())
+		types[field.Name()] = field.Type().String()
+	}
+	assert.Equal(t, map[string]string{
+		"time":   "TIMESTAMP(isAdjustedToUTC=true,unit=MILLIS)",
+		"msg":    "STRING",
+		"status": "DOUBLE",
+		"ok":     "BOOLEAN",
+		"http":   "STRING",
+	}, types)
+
+	reader, err := ParquetCodec{}.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, `{"msg":"first","ok":true,"status":200,"time":"2024-03-01T10:00:00.123Z"}
+{"http":"{\"path\":\"/\"}","msg":"second","status":200.5,"time":"2024-03-01T10:00:01Z"}
+`, string(out))
+}
+
+func TestParquetCodecColumns(t *testing.T) {
+	codec := ParquetCodec{Columns: []ParquetColumn{
+		{Name: "time", Type: ParquetTimestamp},
+		{Name: "status", Path: "http.status", Type: ParquetInt64},
+		{Name: "msg", Type: ParquetString},
+	}}
+	var buf bytes.Buffer
+	w, err := codec.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"time":1709287200.5,"msg":"a","http":{"status":404},"dropped":1}` + "\n" + `{"time":"soon","http":{"status":"bad"}}` + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	reader, err := codec.NewReader(&buf)
+	require.NoError(t, err)
+	out, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, `{"msg":"a","status":404,"time":"2024-03-01T10:00:00.5Z"}
+{}
+`, string(out))
+}
+
+func TestParquetCodecErrors(t *testing.T) {
+	l, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithCodec(ParquetCodec{}))
+	require.NoError(t, err)
+	assert.ErrorIs(t, l.Write([]byte("plain text\n")), ErrInvalidParquetRecord)
+	assert.ErrorIs(t, l.Write([]byte(`["array"]`+"\n")), ErrInvalidParquetRecord)
+	assert.Zero(t, l.records)
+
+	_, err = New("foundry-curation-test", s3MockClient{}, WithCodec(ParquetCodec{Columns: []ParquetColumn{{Name: "a"}, {Name: "a"}}}))
+	assert.ErrorContains(t, err, "duplicate parquet column a")
+	_, err = New("foundry-curation-test", s3MockClient{}, WithCodec(ParquetCodec{Columns: []ParquetColumn{{Type: ParquetBool}}}))
+	assert.Error(t, err)
+	_, err = New("foundry-curation-test", s3MockClient{}, WithCodec(ParquetCodec{}), WithMultipartUpload(5<<20))
+	assert.Error(t, err)
+}
+
+func TestParquetCodecRotation(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 2)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(ParquetCodec{}), WithMaxFileSize(30))
+	require.NoError(t, err)
+
+	require.NoError(t, l.WriteJSON(map[string]string{"msg": "first record"}))
+	require.NoError(t, l.WriteJSON(map[string]string{"msg": "second record"}))
+	require.NoError(t, l.WriteJSON(map[string]string{"msg": "third record"}))
+
+	<-client.debugChan
+	assert.EqualValues(t, 1, l.records)
+}
+
+func TestParquetCodecInfersSchemaPerChunk(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 2)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithCodec(ParquetCodec{}),
+		WithRecordDelimiter([]byte{0x1e}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.WriteJSON(map[string]any{"msg": "first", "status": 200}))
+	require.NoError(t, l.WriteJSON(map[string]any{"msg": "second", "status": 404}))
+	require.NoError(t, l.Sync())
+	require.NoError(t, l.WriteJSON(map[string]any{"msg": "third", "status": "bad", "extra": true}))
+	require.NoError(t, l.Sync())
+
+	var outputs []string
+	for i := 0; i < 2; i++ {
+		data, err := io.ReadAll((<-client.debugChan).(*s3.PutObjectInput).Body)
+		require.NoError(t, err)
+		records, err := Object{Data: data, Codec: l.codec, Delimiter: l.delimiter}.Split()
+		require.NoError(t, err)
+		assert.Len(t, records, 2-i)
+		reader, err := ParquetCodec{}.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		out, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		outputs = append(outputs, string(out))
+	}
+	assert.Equal(t, []string{
+		`{"msg":"first","status":200}` + "\n" + `{"msg":"second","status":404}` + "\n",
+		`{"extra":true,"msg":"third","status":"bad"}` + "\n",
+	}, outputs)
+}
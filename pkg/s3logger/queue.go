@@ -0,0 +1,96 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+)
+
+// WithUploadConcurrency sets how many rotated chunks are uploaded in
+// parallel, it defaults to 4.
+func WithUploadConcurrency(n int) Option {
+	return func(l *S3Logger) error {
+		if n < 1 {
+			return errors.New("upload concurrency must be at least 1")
+		}
+		l.uploadConcurrency = n
+		return nil
+	}
+}
+
+// enqueue hands a rotated chunk to the upload workers. It must be called
+// with l.mutex held.
+func (l *S3Logger) enqueue(c *chunk) {
+	l.enqueued++
+	c.seq = l.enqueued
+	l.queue = append(l.queue, c)
+	l.inFlightBytes += c.size()
+	l.cond.Broadcast()
+}
+
+func (l *S3Logger) startUploaders() {
+	for i := 0; i < l.uploadConcurrency; i++ {
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			for {
+				l.mutex.Lock()
+				for len(l.queue) == 0 && !l.closed.Load() {
+					l.cond.Wait()
+				}
+				if len(l.queue) == 0 {
+					l.unlock()
+					return
+				}
+				c := l.queue[0]
+				l.queue[0] = nil
+				l.queue = l.queue[1:]
+				l.uploading[c.seq] = struct{}{}
+				l.unlock()
+
+				l.backgroundFlush(c)
+				l.uploaded(c)
+			}
+		}()
+	}
+}
+
+// uploaded marks a dequeued chunk as done, frees its memory and wakes up
+// blocked writers and waiting syncs.
+func (l *S3Logger) uploaded(c *chunk) {
+	l.mutex.Lock()
+	l.inFlightBytes -= c.size()
+	if c.seq == l.protectedSeq {
+		l.protectedBytes = 0
+	}
+	delete(l.uploading, c.seq)
+	l.cond.Broadcast()
+	l.unlock()
+}
+
+// waitUploaded waits until the chunks queued up to seq are uploaded or
+// dropped, or ctx is done.
+func (l *S3Logger) waitUploaded(ctx context.Context, seq uint64) error {
+	l.mutex.Lock()
+	defer l.unlock()
+	for l.pendingUpTo(seq) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		l.waitContext(ctx)
+	}
+	return nil
+}
+
+// pendingUpTo reports whether a chunk queued up to seq is queued or being
+// uploaded. It must be called with l.mutex held.
+func (l *S3Logger) pendingUpTo(seq uint64) bool {
+	if len(l.queue) > 0 && l.queue[0].seq <= seq {
+		return true
+	}
+	for s := range l.uploading {
+		if s <= seq {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package reader
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Filter selects records.
+type Filter func(r Record) bool
+
+// Field returns the value of a field of a JSON record. Nested fields are
+// separated by dots, e.g. "request.method".
+func Field(r Record, path string) (any, bool) {
+	var v any = r.Fields
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[name]
+		if !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// FieldString returns a field formatted as string. Objects and arrays are
+// returned as JSON.
+func FieldString(r Record, path string) (string, bool) {
+	v, ok := Field(r, path)
+	if !ok {
+		return "", false
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "null", true
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		return string(data), err == nil
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// Exists matches records having the field.
+func Exists(path string) Filter {
+	return func(r Record) bool {
+		_, ok := Field(r, path)
+		return ok
+	}
+}
+
+// Equals matches records whose field formatted as string equals value.
+func Equals(path, value string) Filter {
+	return func(r Record) bool {
+		s, ok := FieldString(r, path)
+		return ok && s == value
+	}
+}
+
+// Contains matches records whose field formatted as string contains substr.
+func Contains(path, substr string) Filter {
+	return func(r Record) bool {
+		s, ok := FieldString(r, path)
+		return ok && strings.Contains(s, substr)
+	}
+}
+
+// Matches matches records whose field formatted as string matches re.
+func Matches(path string, re *regexp.Regexp) Filter {
+	return func(r Record) bool {
+		s, ok := FieldString(r, path)
+		return ok && re.MatchString(s)
+	}
+}
+
+// Not inverts a filter.
+func Not(f Filter) Filter {
+	return func(r Record) bool {
+		return !f(r)
+	}
+}
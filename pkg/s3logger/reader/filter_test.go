@@ -0,0 +1,59 @@
+package reader
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilters(t *testing.T) {
+	r, err := New("bucket", nil)
+	require.NoError(t, err)
+	record := r.parse("key", time.Time{}, []byte(`{"level":"ERROR","status":503,"ok":false,"user":null,"request":{"path":"/api/items","tags":["a","b"]}}`))
+
+	tests := []struct {
+		name   string
+		filter Filter
+		match  bool
+	}{
+		{"exists", Exists("request.path"), true},
+		{"not exists", Exists("request.query"), false},
+		{"equals string", Equals("level", "ERROR"), true},
+		{"equals number", Equals("status", "503"), true},
+		{"equals bool", Equals("ok", "false"), true},
+		{"equals null", Equals("user", "null"), true},
+		{"equals array", Equals("request.tags", `["a","b"]`), true},
+		{"equals mismatch", Equals("level", "INFO"), false},
+		{"contains", Contains("request.path", "/api/"), true},
+		{"matches", Matches("status", regexp.MustCompile(`^5\d\d$`)), true},
+		{"not", Not(Equals("level", "ERROR")), false},
+		{"missing parent", Equals("level.name", "ERROR"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.filter(record))
+		})
+	}
+
+	plain := r.parse("key", time.Time{}, []byte("plain text"))
+	assert.Nil(t, plain.Fields)
+	assert.False(t, Exists("level")(plain))
+}
+
+func TestParseTime(t *testing.T) {
+	r, err := New("bucket", nil, WithTimeField("ts"))
+	require.NoError(t, err)
+	modified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	record := r.parse("key", modified, []byte(`{"ts":1709287200.5}`))
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 500_000_000, time.UTC), record.Time.UTC())
+
+	record = r.parse("key", modified, []byte(`{"ts":"2024-03-01T11:00:00+01:00"}`))
+	assert.True(t, modified.Equal(record.Time))
+
+	record = r.parse("key", modified, []byte(`{"time":"2024-03-01T12:00:00Z"}`))
+	assert.Equal(t, modified, record.Time)
+}
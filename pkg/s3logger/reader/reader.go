@@ -0,0 +1,459 @@
+// Package reader reads back the logs written by s3logger.S3Logger. It lists
+// the objects of a time range using the key layout of the logger, decompresses
+// them and streams the records in timestamp order.
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+// Client is the part of the S3 API used by the Reader.
+type Client interface {
+	s3.ListObjectsV2APIClient
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Layout returns the key prefix of all objects uploaded in the hour of t. It
+// must match the s3logger.KeyBuilder of the logger.
+type Layout func(prefix string, t time.Time) string
+
+// DefaultLayout matches s3logger.DefaultKeyLayout.
+func DefaultLayout(prefix string, t time.Time) string {
+	return prefix + t.Format("2006/01/02/15/")
+}
+
+// HiveLayout matches s3logger.HiveKeyLayout.
+func HiveLayout(prefix string, t time.Time) string {
+	return prefix + s3logger.HivePartitions(t) + "/"
+}
+
+// FlatLayout matches s3logger.FlatKeyLayout.
+func FlatLayout(prefix string, t time.Time) string {
+	return prefix + t.Format("20060102T15")
+}
+
+// Record is a single log record.
+type Record struct {
+	// Key of the object holding the record.
+	Key string
+	// Time is taken from the time field of the record, or the modification
+	// time of the object if the record has none.
+	Time time.Time
+	// Data is the record without delimiter.
+	Data []byte
+	// Fields is the decoded record, nil if it is not a JSON object.
+	Fields map[string]any
+}
+
+type Reader struct {
+	bucket       string
+	client       Client
+	prefix       string
+	layout       Layout
+	location     *time.Location
+	timeField    string
+	filters      []Filter
+	keyWrapper   s3logger.KeyWrapper
+	uploadDelay  time.Duration
+	pollInterval time.Duration
+	delimiter    []byte
+	maxRecord    int
+}
+
+type Option func(r *Reader) error
+
+// WithPrefix sets the prefix the logger was created with.
+func WithPrefix(prefix string) Option {
+	return func(r *Reader) error {
+		r.prefix = prefix
+		return nil
+	}
+}
+
+// WithLayout sets the key layout, DefaultLayout by default.
+func WithLayout(layout Layout) Option {
+	return func(r *Reader) error {
+		if layout == nil {
+			return errors.New("layout must not be nil")
+		}
+		r.layout = layout
+		return nil
+	}
+}
+
+// WithLocation sets the location the keys were written in, time.Local by
+// default like s3logger.WithKeyLocation.
+func WithLocation(loc *time.Location) Option {
+	return func(r *Reader) error {
+		if loc == nil {
+			return errors.New("location must not be nil")
+		}
+		r.location = loc
+		return nil
+	}
+}
+
+// WithTimeField sets the field holding the record timestamp, "time" by
+// default. RFC 3339 strings and unix seconds are supported.
+func WithTimeField(field string) Option {
+	return func(r *Reader) error {
+		r.timeField = field
+		return nil
+	}
+}
+
+// WithFilters only returns records matching all filters.
+func WithFilters(filters ...Filter) Option {
+	return func(r *Reader) error {
+		r.filters = append(r.filters, filters...)
+		return nil
+	}
+}
+
+// WithKeyWrapper decrypts objects written with s3logger.WithClientSideEncryption.
+func WithKeyWrapper(w s3logger.KeyWrapper) Option {
+	return func(r *Reader) error {
+		r.keyWrapper = w
+		return nil
+	}
+}
+
+// WithUploadDelay sets the maximum time between writing a record and the
+// upload of its object, 10 minutes by default. Records are held back that
+// long to return them in order.
+func WithUploadDelay(d time.Duration) Option {
+	return func(r *Reader) error {
+		if d < 0 {
+			return errors.New("upload delay must not be negative")
+		}
+		r.uploadDelay = d
+		return nil
+	}
+}
+
+// WithPollInterval sets how often Tail looks for new objects, 10 seconds by
+// default.
+func WithPollInterval(d time.Duration) Option {
+	return func(r *Reader) error {
+		if d <= 0 {
+			return errors.New("poll interval must be positive")
+		}
+		r.pollInterval = d
+		return nil
+	}
+}
+
+// WithRecordDelimiter sets the delimiter the records were written with, see
+// s3logger.WithRecordDelimiter. It defaults to a newline. Records of Parquet
+// objects are always split at newlines.
+func WithRecordDelimiter(delimiter []byte) Option {
+	return func(r *Reader) error {
+		if len(delimiter) == 0 {
+			return errors.New("record delimiter must not be empty")
+		}
+		r.delimiter = bytes.Clone(delimiter)
+		return nil
+	}
+}
+
+// WithMaxRecordSize sets the size of the largest record that can be read,
+// 16 MiB by default. Reading an object with a larger record fails.
+func WithMaxRecordSize(n int) Option {
+	return func(r *Reader) error {
+		if n <= 0 {
+			return errors.New("max record size must be positive")
+		}
+		r.maxRecord = n
+		return nil
+	}
+}
+
+func New(bucket string, client Client, opts ...Option) (*Reader, error) {
+	r := &Reader{
+		bucket:       bucket,
+		client:       client,
+		layout:       DefaultLayout,
+		location:     time.Local,
+		timeField:    "time",
+		uploadDelay:  10 * time.Minute,
+		pollInterval: 10 * time.Second,
+		delimiter:    []byte("\n"),
+		maxRecord:    16 * 1024 * 1024,
+	}
+	for _, opt := range opts {
+		err := opt(r)
+		if err != nil {
+			return nil, fmt.Errorf("could not apply option: %w", err)
+		}
+	}
+	return r, nil
+}
+
+// Read calls fn for all records in [from, to) in timestamp order. It stops at
+// the first error returned by fn.
+func (r *Reader) Read(ctx context.Context, from, to time.Time, fn func(Record) error) error {
+	if !to.After(from) {
+		return errors.New("to must be after from")
+	}
+	var pending []Record
+	for hour := r.truncate(from); hour.Before(to.Add(r.uploadDelay)); hour = hour.Add(time.Hour) {
+		keys, err := r.List(ctx, hour)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			records, err := r.readObject(ctx, key, from, to)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, records...)
+		}
+		sortRecords(pending)
+		// objects of the following hours only hold records after the watermark
+		watermark := hour.Add(time.Hour - r.uploadDelay)
+		n := sort.Search(len(pending), func(i int) bool { return !pending[i].Time.Before(watermark) })
+		err = emit(pending[:n], fn)
+		if err != nil {
+			return err
+		}
+		pending = append([]Record(nil), pending[n:]...)
+	}
+	return emit(pending, fn)
+}
+
+// Tail calls fn for all records since from and keeps polling for new objects
+// until ctx is done. Records are ordered within each poll only.
+func (r *Reader) Tail(ctx context.Context, from time.Time, fn func(Record) error) error {
+	seen := map[string]time.Time{}
+	start := r.truncate(from)
+	for {
+		now := time.Now()
+		var batch []Record
+		for hour := start; !hour.After(now); hour = hour.Add(time.Hour) {
+			keys, err := r.List(ctx, hour)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = hour
+				records, err := r.readObject(ctx, key, from, time.Time{})
+				if err != nil {
+					return err
+				}
+				batch = append(batch, records...)
+			}
+		}
+		sortRecords(batch)
+		err := emit(batch, fn)
+		if err != nil {
+			return err
+		}
+
+		// objects may still show up in the previous hour right after it ended
+		if last := r.truncate(now).Add(-time.Hour); last.After(start) {
+			start = last
+		}
+		for key, hour := range seen {
+			if hour.Before(start) {
+				delete(seen, key)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.pollInterval):
+		}
+	}
+}
+
+// ReadKeys calls fn for all records of the given objects, one object after
+// the other and the records of each in timestamp order, so only one object
+// is held in memory.
+func (r *Reader) ReadKeys(ctx context.Context, keys []string, fn func(Record) error) error {
+	for _, key := range keys {
+		records, err := r.readObject(ctx, key, time.Time{}, time.Time{})
+		if err != nil {
+			return err
+		}
+		sortRecords(records)
+		err = emit(records, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate returns the start of the hour of t in the key location.
+func (r *Reader) truncate(t time.Time) time.Time {
+	t = t.In(r.location)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, r.location)
+}
+
+// List returns the keys of the objects uploaded in the hour of t.
+func (r *Reader) List(ctx context.Context, t time.Time) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(r.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(r.bucket),
+		Prefix: aws.String(r.layout(r.prefix, r.truncate(t))),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not list objects: %w", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+// readObject returns the records of an object in [from, to) that match the
+// filters. A zero to is unbounded. Objects not written by s3logger are skipped.
+func (r *Reader) readObject(ctx context.Context, key string, from, to time.Time) ([]Record, error) {
+	encrypted := strings.HasSuffix(key, s3logger.EncryptedExtension)
+	codec, ok := s3logger.CodecForKey(strings.TrimSuffix(key, s3logger.EncryptedExtension))
+	if !ok {
+		return nil, nil
+	}
+	out, err := r.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not get object %s: %w", key, err)
+	}
+	defer out.Body.Close()
+
+	var body io.Reader = out.Body
+	if encrypted {
+		if r.keyWrapper == nil {
+			return nil, fmt.Errorf("object %s is encrypted but no key wrapper is set", key)
+		}
+		ciphertext, err := io.ReadAll(out.Body)
+		if err != nil {
+			return nil, fmt.Errorf("could not read object %s: %w", key, err)
+		}
+		plaintext, err := s3logger.DecryptEnvelope(r.keyWrapper, out.Metadata, ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("could not decrypt object %s: %w", key, err)
+		}
+		body = bytes.NewReader(plaintext)
+	}
+	reader, err := codec.NewReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress object %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	var records []Record
+	delimiter := r.delimiter
+	if _, ok := codec.(s3logger.ParquetCodec); ok {
+		delimiter = []byte("\n")
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, min(64*1024, r.maxRecord)), r.maxRecord)
+	scanner.Split(splitRecords(delimiter))
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := r.parse(key, aws.ToTime(out.LastModified), scanner.Bytes())
+		if record.Time.Before(from) || (!to.IsZero() && !record.Time.Before(to)) || !r.match(record) {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read object %s: %w", key, err)
+	}
+	return records, nil
+}
+
+// splitRecords splits at delimiter, the last record may lack it.
+func splitRecords(delimiter []byte) bufio.SplitFunc {
+	if bytes.Equal(delimiter, []byte("\n")) {
+		return bufio.ScanLines
+	}
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		if i := bytes.Index(data, delimiter); i >= 0 {
+			return i + len(delimiter), data[:i], nil
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+func (r *Reader) parse(key string, modified time.Time, line []byte) Record {
+	record := Record{Key: key, Time: modified, Data: append([]byte(nil), line...)}
+	decoder := json.NewDecoder(bytes.NewReader(record.Data))
+	decoder.UseNumber()
+	if decoder.Decode(&record.Fields) != nil {
+		record.Fields = nil
+		return record
+	}
+	if t, ok := parseTime(record.Fields[r.timeField]); ok {
+		record.Time = t
+	}
+	return record
+}
+
+func parseTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+	}
+	return time.Time{}, false
+}
+
+func (r *Reader) match(record Record) bool {
+	for _, f := range r.filters {
+		if !f(record) {
+			return false
+		}
+	}
+	return true
+}
+
+func sortRecords(records []Record) {
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.Before(records[j].Time) })
+}
+
+func emit(records []Record, fn func(Record) error) error {
+	for _, record := range records {
+		err := fn(record)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,311 @@
+package reader
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+type object struct {
+	data     []byte
+	metadata map[string]string
+	modified time.Time
+}
+
+// memoryS3Client stores objects in memory. It serves both the S3Logger and the
+// Reader.
+type memoryS3Client struct {
+	mutex   sync.Mutex
+	objects map[string]object
+}
+
+func newMemoryS3Client() *memoryS3Client {
+	return &memoryS3Client{objects: map[string]object{}}
+}
+
+func (c *memoryS3Client) HeadBucket(context.Context, *s3.HeadBucketInput, ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, nil
+}
+
+func (c *memoryS3Client) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.put(aws.ToString(params.Key), data, params.Metadata, time.Now())
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (c *memoryS3Client) CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) DeleteObject(context.Context, *s3.DeleteObjectInput, ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return nil, errors.New("not supported")
+}
+
+func (c *memoryS3Client) ListObjectsV2(_ context.Context, params *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var keys []string
+	for key := range c.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+	}
+	return out, nil
+}
+
+func (c *memoryS3Client) GetObject(_ context.Context, params *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	obj, ok := c.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body:         io.NopCloser(bytes.NewReader(obj.data)),
+		Metadata:     obj.metadata,
+		LastModified: aws.Time(obj.modified),
+	}, nil
+}
+
+func (c *memoryS3Client) put(key string, data []byte, metadata map[string]string, modified time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.objects[key] = object{data: data, metadata: metadata, modified: modified}
+}
+
+// putRecords stores the records gzipped under key.
+func (c *memoryS3Client) putRecords(t *testing.T, key string, records ...string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := s3logger.GzipCodec{}.NewWriter(&buf)
+	require.NoError(t, err)
+	for _, record := range records {
+		_, err = w.Write([]byte(record + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	c.put(key, buf.Bytes(), nil, time.Now())
+}
+
+func readAll(t *testing.T, r *Reader, from, to time.Time) []string {
+	t.Helper()
+	var records []string
+	err := r.Read(context.Background(), from, to, func(record Record) error {
+		records = append(records, string(record.Data))
+		return nil
+	})
+	require.NoError(t, err)
+	return records
+}
+
+func TestReadOrdersRecords(t *testing.T) {
+	client := newMemoryS3Client()
+	client.putRecords(t, "logs/2024/03/01/10/a-1.gz",
+		`{"time":"2024-03-01T10:00:01Z","msg":"a1"}`,
+		`{"time":"2024-03-01T10:00:03Z","msg":"a3"}`)
+	client.putRecords(t, "logs/2024/03/01/10/b-1.gz",
+		`{"time":"2024-03-01T10:00:02Z","msg":"b2"}`,
+		`{"time":"2024-03-01T10:00:04Z","msg":"b4"}`)
+	// uploaded after the hour ended but holds older records
+	client.putRecords(t, "logs/2024/03/01/11/a-2.gz",
+		`{"time":"2024-03-01T10:59:59Z","msg":"a59"}`,
+		`{"time":"2024-03-01T11:00:01Z","msg":"a61"}`)
+	client.putRecords(t, "logs/2024/03/01/11/b-2.gz",
+		`{"time":"2024-03-01T10:58:00Z","msg":"b58"}`)
+	client.put("logs/2024/03/01/10/manifest.json", []byte("{}"), nil, time.Now())
+
+	r, err := New("bucket", client, WithPrefix("logs/"), WithLocation(time.UTC))
+	require.NoError(t, err)
+
+	from := time.Date(2024, 3, 1, 10, 0, 2, 0, time.UTC)
+	to := time.Date(2024, 3, 1, 11, 0, 1, 0, time.UTC)
+	assert.Equal(t, []string{
+		`{"time":"2024-03-01T10:00:02Z","msg":"b2"}`,
+		`{"time":"2024-03-01T10:00:03Z","msg":"a3"}`,
+		`{"time":"2024-03-01T10:00:04Z","msg":"b4"}`,
+		`{"time":"2024-03-01T10:58:00Z","msg":"b58"}`,
+		`{"time":"2024-03-01T10:59:59Z","msg":"a59"}`,
+	}, readAll(t, r, from, to))
+}
+
+func TestReadWithFilters(t *testing.T) {
+	client := newMemoryS3Client()
+	client.putRecords(t, "logs/year=2024/month=03/day=01/hour=10/a-1.gz",
+		`{"time":"2024-03-01T10:00:01Z","level":"INFO","request":{"method":"GET"}}`,
+		`{"time":"2024-03-01T10:00:02Z","level":"ERROR","request":{"method":"POST"}}`,
+		`{"time":"2024-03-01T10:00:03Z","level":"ERROR","request":{"method":"GET"}}`,
+		`not json`)
+
+	r, err := New("bucket", client, WithPrefix("logs/"), WithLayout(HiveLayout), WithLocation(time.UTC),
+		WithFilters(Equals("level", "ERROR"), Equals("request.method", "GET")))
+	require.NoError(t, err)
+
+	from := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, []string{
+		`{"time":"2024-03-01T10:00:03Z","level":"ERROR","request":{"method":"GET"}}`,
+	}, readAll(t, r, from, from.Add(time.Hour)))
+}
+
+func TestReadLoggerOutput(t *testing.T) {
+	client := newMemoryS3Client()
+	w, err := s3logger.NewAESKeyWrapper(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	l, err := s3logger.New("bucket", client, s3logger.WithoutBatchFrequency(), s3logger.WithPrefix("logs/"),
+		s3logger.WithKeyLocation(time.UTC), s3logger.WithCodec(s3logger.ZstdCodec{}), s3logger.WithClientSideEncryption(w))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, l.WriteJSON(map[string]any{"time": start.Add(time.Second), "msg": "second"}))
+	require.NoError(t, l.WriteJSON(map[string]any{"time": start, "msg": "first"}))
+	require.NoError(t, l.Close(context.Background()))
+
+	r, err := New("bucket", client, WithPrefix("logs/"), WithLocation(time.UTC), WithKeyWrapper(w))
+	require.NoError(t, err)
+	var msgs []string
+	err = r.Read(context.Background(), start.Add(-time.Minute), start.Add(time.Minute), func(record Record) error {
+		msgs = append(msgs, record.Fields["msg"].(string))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, msgs)
+
+	r, err = New("bucket", client, WithPrefix("logs/"), WithLocation(time.UTC))
+	require.NoError(t, err)
+	err = r.Read(context.Background(), start.Add(-time.Minute), start.Add(time.Minute), func(Record) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestReadRecordDelimiter(t *testing.T) {
+	client := newMemoryS3Client()
+	l, err := s3logger.New("bucket", client, s3logger.WithoutBatchFrequency(), s3logger.WithKeyLocation(time.UTC),
+		s3logger.WithRecordDelimiter([]byte{0x1e}))
+	require.NoError(t, err)
+
+	start := time.Now().UTC()
+	pretty := `{"time":"` + start.Format(time.RFC3339Nano) + `",` + "\n" + `"msg":"pretty"}`
+	large := `{"time":"` + start.Add(time.Second).Format(time.RFC3339Nano) + `","msg":"` + strings.Repeat("x", 100*1024) + `"}`
+	require.NoError(t, l.WriteRecord([]byte(pretty)))
+	require.NoError(t, l.WriteRecord([]byte(large)))
+	require.NoError(t, l.Close(context.Background()))
+
+	r, err := New("bucket", client, WithLocation(time.UTC), WithRecordDelimiter([]byte{0x1e}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{pretty, large}, readAll(t, r, start.Add(-time.Minute), start.Add(time.Minute)))
+
+	r, err = New("bucket", client, WithLocation(time.UTC), WithRecordDelimiter([]byte{0x1e}), WithMaxRecordSize(64*1024))
+	require.NoError(t, err)
+	err = r.Read(context.Background(), start.Add(-time.Minute), start.Add(time.Minute), func(Record) error { return nil })
+	assert.ErrorIs(t, err, bufio.ErrTooLong)
+
+	_, err = New("bucket", client, WithRecordDelimiter(nil))
+	assert.Error(t, err)
+}
+
+func TestReadStopsOnCallbackError(t *testing.T) {
+	client := newMemoryS3Client()
+	client.putRecords(t, "logs/2024/03/01/10/a-1.gz",
+		`{"time":"2024-03-01T10:00:01Z"}`,
+		`{"time":"2024-03-01T10:00:02Z"}`)
+	r, err := New("bucket", client, WithPrefix("logs/"), WithLocation(time.UTC))
+	require.NoError(t, err)
+
+	stop := errors.New("stop")
+	calls := 0
+	from := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	err = r.Read(context.Background(), from, from.Add(time.Hour), func(Record) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+
+	err = r.Read(context.Background(), from, from, func(Record) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestTail(t *testing.T) {
+	client := newMemoryS3Client()
+	now := time.Now().UTC()
+	key := func(name string) string { return "logs/" + now.Format("2006/01/02/15/") + name + ".gz" }
+	client.putRecords(t, key("a"), `{"time":"`+now.Format(time.RFC3339Nano)+`","msg":"existing"}`)
+
+	r, err := New("bucket", client, WithPrefix("logs/"), WithLocation(time.UTC), WithPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	records := make(chan string, 10)
+	done := make(chan error)
+	go func() {
+		done <- r.Tail(ctx, now.Add(-time.Minute), func(record Record) error {
+			records <- record.Fields["msg"].(string)
+			return nil
+		})
+	}()
+	assert.Equal(t, "existing", <-records)
+
+	client.putRecords(t, key("b"), `{"time":"`+now.Add(time.Second).Format(time.RFC3339Nano)+`","msg":"new"}`)
+	assert.Equal(t, "new", <-records)
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, records)
+}
+
+func TestListAndReadKeys(t *testing.T) {
+	client := newMemoryS3Client()
+	client.putRecords(t, "logs/2024/03/01/10/a-1.gz", `{"time":"2024-03-01T10:00:03Z"}`, `no time`)
+	client.putRecords(t, "logs/2024/03/01/10/b-1.gz", `{"time":"2024-03-01T10:00:01Z"}`)
+	client.putRecords(t, "logs/2024/03/01/11/a-2.gz", `{"time":"2024-03-01T11:00:01Z"}`)
+	modified := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	client.objects["logs/2024/03/01/10/a-1.gz"] = object{data: client.objects["logs/2024/03/01/10/a-1.gz"].data, modified: modified}
+
+	r, err := New("bucket", client, WithPrefix("logs/"), WithLocation(time.UTC))
+	require.NoError(t, err)
+	keys, err := r.List(context.Background(), time.Date(2024, 3, 1, 10, 42, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs/2024/03/01/10/a-1.gz", "logs/2024/03/01/10/b-1.gz"}, keys)
+
+	var records []string
+	err = r.ReadKeys(context.Background(), keys, func(record Record) error {
+		records = append(records, string(record.Data))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"time":"2024-03-01T10:00:03Z"}`, `no time`, `{"time":"2024-03-01T10:00:01Z"}`}, records)
+}
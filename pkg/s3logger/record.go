@@ -0,0 +1,67 @@
+package s3logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// ErrDelimiterInRecord is returned by WriteRecord for records containing the
+// record delimiter anywhere but at their end.
+var ErrDelimiterInRecord = errors.New("s3logger: record contains the record delimiter")
+
+// WithRecordDelimiter sets the delimiter appended by WriteRecord and
+// WriteJSON, it defaults to a newline (NDJSON).
+func WithRecordDelimiter(delimiter []byte) Option {
+	return func(l *S3Logger) error {
+		if len(delimiter) == 0 {
+			return errors.New("record delimiter must not be empty")
+		}
+		l.delimiter = bytes.Clone(delimiter)
+		return nil
+	}
+}
+
+// WriteRecord writes p as one record terminated by the record delimiter,
+// which is only appended if p does not end with it already. A record is
+// always written to a single object. Records are redacted if WithRedaction
+// is set.
+func (l *S3Logger) WriteRecord(p []byte) error {
+	body := bytes.TrimSuffix(p, l.delimiter)
+	if l.redactor != nil {
+		body = l.redactor.Redact(body)
+	}
+	if bytes.Contains(body, l.delimiter) {
+		return ErrDelimiterInRecord
+	}
+	record := make([]byte, 0, len(body)+len(l.delimiter))
+	record = append(record, body...)
+	record = append(record, l.delimiter...)
+	return l.Write(record)
+}
+
+// escapeDelimiter replaces the record delimiters within p, but not at its
+// end, by their escape sequence like \n, or by a space for printable
+// delimiters.
+func (l *S3Logger) escapeDelimiter(p []byte) []byte {
+	body := bytes.TrimSuffix(p, l.delimiter)
+	if !bytes.Contains(body, l.delimiter) {
+		return p
+	}
+	quoted := strconv.Quote(string(l.delimiter))
+	escaped := quoted[1 : len(quoted)-1]
+	if escaped == string(l.delimiter) {
+		escaped = " "
+	}
+	return bytes.ReplaceAll(body, l.delimiter, []byte(escaped))
+}
+
+// WriteJSON writes v as one JSON encoded record.
+func (l *S3Logger) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return l.WriteRecord(data)
+}
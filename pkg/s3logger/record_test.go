@@ -0,0 +1,63 @@
+package s3logger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteRecord(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency())
+	require.NoError(t, err)
+
+	require.NoError(t, l.WriteRecord([]byte(`{"a":1}`)))
+	require.NoError(t, l.WriteRecord([]byte(`{"a":2}`+"\n")))
+	assert.ErrorIs(t, l.WriteRecord([]byte("two\nlines")), ErrDelimiterInRecord)
+	require.NoError(t, l.WriteJSON(map[string]any{"msg": "multi\nline"}))
+	assert.Error(t, l.WriteJSON(func() {}))
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, `{"a":1}`+"\n"+`{"a":2}`+"\n"+`{"msg":"multi\nline"}`+"\n", readBody(t, rs))
+}
+
+func TestWriteRecordCustomDelimiter(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithRecordDelimiter([]byte{0x1e}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.WriteRecord([]byte("multi\nline")))
+	require.NoError(t, l.WriteRecord([]byte("second")))
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "multi\nline\x1esecond\x1e", readBody(t, rs))
+}
+
+func TestRecordsAreNotSplit(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 100)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithMaxUncompressedSize(1000))
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.WriteJSON(map[string]any{"i": i, "padding": strings.Repeat("p", i)}))
+	}
+	require.NoError(t, l.Close(t.Context()))
+
+	var records int
+	for len(client.debugChan) > 0 {
+		body := readBody(t, (<-client.debugChan).(*s3.PutObjectInput))
+		require.True(t, strings.HasSuffix(body, "\n"))
+		for _, line := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+			assert.True(t, strings.HasPrefix(line, `{"i":`), line)
+			assert.True(t, strings.HasSuffix(line, `"}`), line)
+			records++
+		}
+	}
+	assert.Equal(t, 100, records)
+}
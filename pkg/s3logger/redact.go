@@ -0,0 +1,392 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Mask replaces every match of Pattern in values by Replacement, or by the
+// hash of the match if Hash is set.
+type Mask struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+	Hash        bool
+}
+
+var (
+	EmailMask = Mask{Pattern: regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`), Replacement: "[EMAIL]"}
+	IPv4Mask  = Mask{Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`), Replacement: "[IP]"}
+	IPv6Mask  = Mask{Pattern: regexp.MustCompile(`\b(?:[0-9a-fA-F]{1,4}:){7}[0-9a-fA-F]{1,4}\b`), Replacement: "[IP]"}
+	TokenMask = Mask{Pattern: regexp.MustCompile(`(?i)\b(?:bearer\s+)[a-z0-9\-._~+/]+=*|\beyJ[a-zA-Z0-9_\-]+\.[a-zA-Z0-9_\-]+\.[a-zA-Z0-9_\-]+`), Replacement: "[TOKEN]"}
+)
+
+// RedactionPolicy removes personal data from records. Drop and Hash name
+// attributes by key or by their dotted path, e.g. "user.email". A name of a
+// group or object applies to all its members. Hashed values are hex encoded
+// HMAC-SHA256 sums with HashKey, so the same value always yields the same
+// hash and stays joinable, but can not be looked up in a dictionary of
+// plain hashes.
+type RedactionPolicy struct {
+	Drop    []string
+	Hash    []string
+	HashKey []byte
+	Masks   []Mask
+}
+
+// Redactor applies a RedactionPolicy to slog attributes, JSON records and
+// plain text.
+type Redactor struct {
+	policy RedactionPolicy
+}
+
+func NewRedactor(p RedactionPolicy) (*Redactor, error) {
+	hashing := len(p.Hash) > 0
+	for _, m := range p.Masks {
+		hashing = hashing || m.Hash
+	}
+	if hashing && len(p.HashKey) == 0 {
+		return nil, errors.New("hashing needs a hash key")
+	}
+	return &Redactor{policy: p}, nil
+}
+
+func (r *Redactor) hash(value string) string {
+	mac := hmac.New(sha256.New, r.policy.HashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func matchesKey(keys []string, groups []string, key string) bool {
+	if slices.Contains(keys, key) {
+		return true
+	}
+	if len(groups) == 0 {
+		return false
+	}
+	return slices.Contains(keys, strings.Join(append(slices.Clip(groups), key), "."))
+}
+
+// matchesPath reports whether keys name the attribute or one of its groups.
+func matchesPath(keys []string, groups []string, key string) bool {
+	for i := range groups {
+		if matchesKey(keys, groups[:i], groups[i]) {
+			return true
+		}
+	}
+	return matchesKey(keys, groups, key)
+}
+
+// Mask applies the masks to a string.
+func (r *Redactor) Mask(s string) string {
+	for _, m := range r.policy.Masks {
+		if m.Hash {
+			s = m.Pattern.ReplaceAllStringFunc(s, r.hash)
+		} else {
+			s = m.Pattern.ReplaceAllLiteralString(s, m.Replacement)
+		}
+	}
+	return s
+}
+
+// ReplaceAttr can be used as slog.HandlerOptions.ReplaceAttr. slog does not
+// pass groups to it, so it can not remove them, use Handler instead.
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if matchesPath(r.policy.Drop, groups, a.Key) {
+		return slog.Attr{}
+	}
+	return r.redactLeaf(groups, a, matchesPath(r.policy.Hash, groups, a.Key))
+}
+
+// redactAttr redacts a and the members of a group like the fields of a JSON
+// record. It reports false if a is dropped.
+func (r *Redactor) redactAttr(groups []string, a slog.Attr, hash bool) (slog.Attr, bool) {
+	if a.Key != "" && matchesKey(r.policy.Drop, groups, a.Key) {
+		return slog.Attr{}, false
+	}
+	hash = hash || (a.Key != "" && matchesKey(r.policy.Hash, groups, a.Key))
+	a.Value = a.Value.Resolve()
+	if a.Value.Kind() != slog.KindGroup {
+		return r.redactLeaf(groups, a, hash), true
+	}
+	if a.Key != "" {
+		groups = append(slices.Clip(groups), a.Key)
+	}
+	members := r.redactAttrs(groups, a.Value.Group(), hash)
+	if len(members) == 0 {
+		return slog.Attr{}, false
+	}
+	return slog.Attr{Key: a.Key, Value: slog.GroupValue(members...)}, true
+}
+
+func (r *Redactor) redactAttrs(groups []string, attrs []slog.Attr, hash bool) []slog.Attr {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a, ok := r.redactAttr(groups, a, hash); ok {
+			redacted = append(redacted, a)
+		}
+	}
+	return redacted
+}
+
+// redactLeaf hashes or masks a value which is not a group. Values of other
+// kinds than strings are masked in their text form, errors by their message
+// and other values by their JSON encoding, which is redacted like a JSON
+// record.
+func (r *Redactor) redactLeaf(groups []string, a slog.Attr, hash bool) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		return a
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			v = slog.StringValue(err.Error())
+			break
+		}
+		decoded, ok := decodeJSON(v.Any())
+		if !ok {
+			v = slog.StringValue(v.String())
+			break
+		}
+		if hash {
+			return slog.Any(a.Key, r.hashAll(decoded))
+		}
+		return slog.Any(a.Key, r.redactValue(append(slices.Clip(groups), a.Key), decoded))
+	}
+	if hash {
+		return slog.String(a.Key, r.hash(v.String()))
+	}
+	if s := v.String(); v.Kind() == slog.KindString || r.Mask(s) != s {
+		return slog.String(a.Key, r.Mask(s))
+	}
+	return a
+}
+
+// decodeJSON converts v to the generic form of its JSON encoding.
+func decodeJSON(v any) (any, bool) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var decoded any
+	if err := dec.Decode(&decoded); err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
+
+// Redact redacts a record. JSON objects are redacted field by field keeping
+// their order, everything else is only masked.
+func (r *Redactor) Redact(record []byte) []byte {
+	trimmed := bytes.TrimSpace(record)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.UseNumber()
+		var out bytes.Buffer
+		if err := r.redactJSON(dec, &out, nil, false); err == nil && !dec.More() {
+			return out.Bytes()
+		}
+	}
+	return []byte(r.Mask(string(record)))
+}
+
+// redactJSON copies the next JSON value of dec to out like redactValue, or
+// like hashAll if hash is set.
+func (r *Redactor) redactJSON(dec *json.Decoder, out *bytes.Buffer, groups []string, hash bool) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		out.WriteRune(rune(tok))
+		first := true
+		for dec.More() {
+			fieldGroups, fieldHash := groups, hash
+			var key string
+			if tok == '{' {
+				t, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				key, _ = t.(string)
+				if !hash && matchesKey(r.policy.Drop, groups, key) {
+					var skipped json.RawMessage
+					if err := dec.Decode(&skipped); err != nil {
+						return err
+					}
+					continue
+				}
+				fieldGroups = append(slices.Clip(groups), key)
+				fieldHash = hash || matchesKey(r.policy.Hash, groups, key)
+			}
+			if !first {
+				out.WriteByte(',')
+			}
+			first = false
+			if tok == '{' {
+				writeJSONString(out, key)
+				out.WriteByte(':')
+			}
+			if err := r.redactJSON(dec, out, fieldGroups, fieldHash); err != nil {
+				return err
+			}
+		}
+		// the closing delimiter
+		end, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		out.WriteRune(rune(end.(json.Delim)))
+	case string:
+		if hash {
+			tok = r.hash(tok)
+		} else {
+			tok = r.Mask(tok)
+		}
+		writeJSONString(out, tok)
+	default:
+		if hash {
+			writeJSONString(out, r.hash(jsonString(tok)))
+		} else {
+			out.WriteString(jsonString(tok))
+		}
+	}
+	return nil
+}
+
+// writeJSONString writes s as a JSON string without escaping HTML.
+func writeJSONString(out *bytes.Buffer, s string) {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	// Encode ends with a newline
+	out.Truncate(out.Len() - 1)
+}
+
+func (r *Redactor) redactMap(groups []string, m map[string]any) {
+	for k, v := range m {
+		switch {
+		case matchesKey(r.policy.Drop, groups, k):
+			delete(m, k)
+		case matchesKey(r.policy.Hash, groups, k):
+			m[k] = r.hashAll(v)
+		default:
+			m[k] = r.redactValue(append(slices.Clip(groups), k), v)
+		}
+	}
+}
+
+func (r *Redactor) redactValue(groups []string, v any) any {
+	switch v := v.(type) {
+	case string:
+		return r.Mask(v)
+	case map[string]any:
+		r.redactMap(groups, v)
+	case []any:
+		for i := range v {
+			v[i] = r.redactValue(groups, v[i])
+		}
+	}
+	return v
+}
+
+// hashAll hashes v, or all members of an object or array.
+func (r *Redactor) hashAll(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k := range v {
+			v[k] = r.hashAll(v[k])
+		}
+	case []any:
+		for i := range v {
+			v[i] = r.hashAll(v[i])
+		}
+	default:
+		return r.hash(jsonString(v))
+	}
+	return v
+}
+
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Handler returns a slog.Handler redacting the message and the attributes of
+// every record before passing it to h. Groups are redacted like the objects
+// of a JSON record.
+func (r *Redactor) Handler(h slog.Handler) slog.Handler {
+	return &redactingHandler{redactor: r, handler: h}
+}
+
+type redactingHandler struct {
+	redactor *Redactor
+	handler  slog.Handler
+	groups   []string
+	// drop and hash are set if Drop or Hash name one of the groups.
+	drop, hash bool
+}
+
+func (h *redactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactor.Mask(record.Message), record.PC)
+	if !h.drop {
+		attrs := make([]slog.Attr, 0, record.NumAttrs())
+		record.Attrs(func(a slog.Attr) bool {
+			attrs = append(attrs, a)
+			return true
+		})
+		redacted.AddAttrs(h.redactor.redactAttrs(h.groups, attrs, h.hash)...)
+	}
+	return h.handler.Handle(ctx, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *h
+	if !h.drop {
+		c.handler = h.handler.WithAttrs(h.redactor.redactAttrs(h.groups, attrs, h.hash))
+	}
+	return &c
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	c := *h
+	c.handler = h.handler.WithGroup(name)
+	c.drop = h.drop || matchesKey(h.redactor.policy.Drop, h.groups, name)
+	c.hash = h.hash || matchesKey(h.redactor.policy.Hash, h.groups, name)
+	c.groups = append(slices.Clip(h.groups), name)
+	return &c
+}
+
+// WithRedaction redacts every record written by WriteRecord, WriteJSON and
+// the record writers. Raw writes are not redacted.
+func WithRedaction(p RedactionPolicy) Option {
+	return func(l *S3Logger) error {
+		redactor, err := NewRedactor(p)
+		if err != nil {
+			return err
+		}
+		l.redactor = redactor
+		return nil
+	}
+}
@@ -0,0 +1,158 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// RetryPolicy controls how failed uploads are retried. Backoff between two
+// attempts starts at InitialBackoff and grows by Multiplier up to MaxBackoff,
+// Jitter randomizes each backoff by up to the given fraction (0..1).
+// MaxElapsedTime bounds the overall time spent on one upload, zero means no
+// bound. Errors failing the same way on every attempt, like AccessDenied or
+// NoSuchBucket, are not retried. With more than one attempt the retryer of
+// the SDK is disabled for S3 requests, so retries do not multiply.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy makes a single upload attempt.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    1,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// UploadErrorHandler receives a chunk that could not be uploaded after all
+// retries, together with its object key and the last error.
+type UploadErrorHandler func(key string, payload []byte, err error)
+
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(l *S3Logger) error {
+		if p.MaxAttempts < 1 {
+			return errors.New("retry policy needs at least one attempt")
+		}
+		if p.Jitter < 0 || p.Jitter > 1 {
+			return errors.New("retry jitter must be between 0 and 1")
+		}
+		if p.Multiplier < 1 {
+			p.Multiplier = 1
+		}
+		l.retryPolicy = p
+		return nil
+	}
+}
+
+// WithOnUploadError registers a dead-letter handler for chunks that are
+// dropped after the retry policy is exhausted. Chunks in a spool dir are
+// never dropped, so the handler is not called for them.
+func WithOnUploadError(fn UploadErrorHandler) Option {
+	return func(l *S3Logger) error {
+		l.onUploadError = fn
+		return nil
+	}
+}
+
+// WithUploadTimeout bounds every attempt of an upload request, including
+// Sink.Put. Attempts running into the timeout are retried according to the
+// retry policy.
+func WithUploadTimeout(d time.Duration) Option {
+	return func(l *S3Logger) error {
+		if d < 0 {
+			return errors.New("upload timeout must not be negative")
+		}
+		l.uploadTimeout = d
+		return nil
+	}
+}
+
+// backoff returns the wait time before the given retry (starting at 1).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+func (p RetryPolicy) do(ctx context.Context, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn(ctx)
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		wait := p.backoff(attempt)
+		if p.MaxElapsedTime > 0 && time.Since(start)+wait > p.MaxElapsedTime {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// nonRetryableCodes are API error codes that fail the same way on every
+// attempt, but are not reported as client faults by all services.
+var nonRetryableCodes = map[string]bool{
+	"AccessDenied":                 true,
+	"AccessDeniedException":        true,
+	"AllAccessDisabled":            true,
+	"InvalidAccessKeyId":           true,
+	"SignatureDoesNotMatch":        true,
+	"NoSuchBucket":                 true,
+	"InvalidBucketName":            true,
+	"InvalidArgument":              true,
+	"InvalidRequest":               true,
+	"InvalidStorageClass":          true,
+	"KMS.NotFoundException":        true,
+	"KMS.DisabledException":        true,
+	"KMS.KMSInvalidStateException": true,
+}
+
+// retryable reports whether another attempt may succeed. Errors the SDK
+// classifies as retryable or throttling are retried, as are errors of
+// unknown origin like timeouts of WithUploadTimeout. API errors are not
+// retried if they are client faults or have a non-retryable code.
+func retryable(err error) bool {
+	if retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err).Bool() ||
+		retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool() {
+		return true
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorFault() != smithy.FaultClient && !nonRetryableCodes[apiErr.ErrorCode()]
+	}
+	return true
+}
+
+// s3Options are passed to every S3 request. They disable the retryer of the
+// SDK while the retry policy makes more than one attempt.
+func (l *S3Logger) s3Options() []func(*s3.Options) {
+	if l.retryPolicy.MaxAttempts <= 1 {
+		return nil
+	}
+	return []func(*s3.Options){func(o *s3.Options) { o.RetryMaxAttempts = 1 }}
+}
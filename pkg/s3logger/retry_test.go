@@ -0,0 +1,150 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyS3Client struct {
+	s3MockClient
+	failures int32
+	calls    atomic.Int32
+}
+
+func (c *flakyS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if c.calls.Add(1) <= c.failures {
+		return nil, errors.New("throttled")
+	}
+	return c.s3MockClient.PutObject(ctx, params, optFns...)
+}
+
+var fastRetries = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     5 * time.Millisecond,
+	Multiplier:     2,
+	Jitter:         0.5,
+}
+
+func TestRetrySucceedsAfterFailures(t *testing.T) {
+	client := &flakyS3Client{failures: 2}
+	var deadLetters int
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithRetryPolicy(fastRetries),
+		WithOnUploadError(func(string, []byte, error) { deadLetters++ }))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("retried line\n")))
+	l.Sync()
+
+	assert.Equal(t, int32(3), client.calls.Load())
+	assert.Zero(t, deadLetters)
+}
+
+func TestRetryExhaustedCallsDeadLetter(t *testing.T) {
+	client := &flakyS3Client{failures: 10}
+	var (
+		gotKey     string
+		gotPayload []byte
+		gotErr     error
+	)
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithRetryPolicy(fastRetries),
+		WithOnUploadError(func(key string, payload []byte, err error) {
+			gotKey, gotPayload, gotErr = key, payload, err
+		}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("lost line\n")))
+	l.Sync()
+
+	assert.Equal(t, int32(3), client.calls.Load())
+	assert.Contains(t, gotKey, l.fileID)
+	assert.NotEmpty(t, gotPayload)
+	assert.EqualError(t, gotErr, "throttled")
+}
+
+func TestUploadTimeout(t *testing.T) {
+	client := blockingS3Client{}
+	var deadLetters int
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithRetryPolicy(fastRetries),
+		WithUploadTimeout(10*time.Millisecond), WithOnUploadError(func(string, []byte, error) { deadLetters++ }))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("hung line\n")))
+	start := time.Now()
+	assert.ErrorIs(t, l.Sync(), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 1, deadLetters)
+
+	_, err = New("foundry-curation-test", client, WithUploadTimeout(-time.Second))
+	assert.Error(t, err)
+}
+
+func TestRetryFailsFastOnPermanentErrors(t *testing.T) {
+	for _, err := range []error{
+		&smithy.GenericAPIError{Code: "AccessDenied", Message: "Access Denied"},
+		&types.NoSuchBucket{},
+		&smithy.GenericAPIError{Code: "KMS.NotFoundException"},
+	} {
+		var calls int
+		assert.Equal(t, err, fastRetries.do(context.Background(), func(context.Context) error {
+			calls++
+			return err
+		}))
+		assert.Equal(t, 1, calls, err.Error())
+	}
+
+	var calls int
+	_ = fastRetries.do(context.Background(), func(context.Context) error {
+		calls++
+		return &smithy.GenericAPIError{Code: "SlowDown"}
+	})
+	assert.Equal(t, 3, calls)
+
+	l, err := New("foundry-curation-test", s3MockClient{}, WithRetryPolicy(fastRetries))
+	require.NoError(t, err)
+	var o s3.Options
+	for _, fn := range l.s3Options() {
+		fn(&o)
+	}
+	assert.Equal(t, 1, o.RetryMaxAttempts)
+}
+
+func TestRetryMaxElapsedTime(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 100, InitialBackoff: 20 * time.Millisecond, Multiplier: 1, MaxElapsedTime: 50 * time.Millisecond}
+	var calls int
+	err := p.do(context.Background(), func(context.Context) error {
+		calls++
+		return errors.New("unavailable")
+	})
+	assert.Error(t, err)
+	assert.GreaterOrEqual(t, calls, 2)
+	assert.LessOrEqual(t, calls, 3)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second, Multiplier: 2}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 2*time.Second, p.backoff(2))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	assert.Equal(t, 5*time.Second, p.backoff(4))
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		assert.InDelta(t, float64(2*time.Second), float64(p.backoff(2)), float64(time.Second))
+	}
+}
+
+func TestRetryPolicyValidation(t *testing.T) {
+	_, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency(), WithRetryPolicy(RetryPolicy{}))
+	assert.Error(t, err)
+}
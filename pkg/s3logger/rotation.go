@@ -0,0 +1,137 @@
+package s3logger
+
+import (
+	"bytes"
+	"time"
+)
+
+// chunk is the content of the logger cut off for upload.
+type chunk struct {
+	buffer *bytes.Buffer
+	// lastPart completes the multipart upload the chunk was streamed to.
+	lastPart *part
+	info     chunkInfo
+	// seq numbers the chunk once it is queued.
+	seq uint64
+	// protected chunks are never dropped, see rotateAlone.
+	protected bool
+}
+
+// chunkInfo describes the records of a chunk.
+type chunkInfo struct {
+	Records uint      `json:"records"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	// Time the object key was built for, set when the chunk is flushed.
+	Time time.Time `json:"time"`
+}
+
+func (c *chunk) size() uint {
+	return uint(c.buffer.Len())
+}
+
+// WithMaxUncompressedSize rotates the chunk once more than size bytes were
+// written to it. Unlike WithMaxFileSize this does not depend on how much
+// output the codec has flushed yet.
+func WithMaxUncompressedSize(size uint) Option {
+	return func(l *S3Logger) error {
+		l.maxUncompressedSize = size
+		return nil
+	}
+}
+
+// WithMaxRecords rotates the chunk once it holds n records, every call of
+// Write counts as one record.
+func WithMaxRecords(n uint) Option {
+	return func(l *S3Logger) error {
+		l.maxRecords = n
+		return nil
+	}
+}
+
+// WithMaxRecordAge rotates the chunk once its oldest record is older than d,
+// independent of the batch frequency.
+func WithMaxRecordAge(d time.Duration) Option {
+	return func(l *S3Logger) error {
+		l.maxRecordAge = d
+		return nil
+	}
+}
+
+// compressedSize returns the bytes the codec has emitted for the current
+// chunk. Codecs buffer internally, so it lags behind the written data.
+// Parquet files are only written on cut, so their uncompressed size is used.
+func (l *S3Logger) compressedSize() uint {
+	if isParquet(l.codec) {
+		return l.uncompressedSize
+	}
+	size := uint(l.buffer.Len())
+	if l.multipart != nil {
+		size += l.multipart.sent
+	}
+	return size
+}
+
+// rotationDue reports whether the current chunk crossed one of the rotation
+// thresholds, a zero threshold is disabled. It must be called with l.mutex
+// held.
+func (l *S3Logger) rotationDue(now time.Time) bool {
+	switch {
+	case l.records == 0:
+		return false
+	case l.maxFileSize > 0 && l.compressedSize() > l.maxFileSize:
+		return true
+	case l.maxUncompressedSize > 0 && l.uncompressedSize > l.maxUncompressedSize:
+		return true
+	case l.maxRecords > 0 && l.records >= l.maxRecords:
+		return true
+	case l.maxRecordAge > 0 && now.Sub(l.oldestRecord) >= l.maxRecordAge:
+		return true
+	}
+	return false
+}
+
+// cut closes the current chunk and starts a new one. It must be called with
+// l.mutex held and returns nil if nothing was written since the last cut.
+func (l *S3Logger) cut() *chunk {
+	if l.records == 0 {
+		return nil
+	}
+	l.encoder.Close()
+	c := &chunk{
+		buffer: l.buffer,
+		info:   chunkInfo{Records: l.records, First: l.oldestRecord, Last: l.newestRecord},
+	}
+	if l.multipart != nil {
+		c.lastPart = l.multipart.number(c.buffer.Bytes())
+	}
+	e := ChunkEvent{Records: l.records, UncompressedBytes: l.uncompressedSize, Bytes: c.buffer.Len()}
+	l.notify(func(o Observer) { o.ChunkCut(e) })
+	l.buffer = &bytes.Buffer{}
+	l.multipart = nil
+	l.records = 0
+	l.uncompressedSize = 0
+	l.oldestRecord = time.Time{}
+	l.newestRecord = time.Time{}
+	l.resetEncoder()
+	return c
+}
+
+// rotate cuts the current chunk and queues it for upload. Writes continue
+// on a fresh chunk, so a crossed threshold triggers exactly one upload. It
+// must be called with l.mutex held.
+func (l *S3Logger) rotate() {
+	c := l.cut()
+	if c == nil {
+		return
+	}
+	if l.ticker != nil {
+		l.ticker.Reset(l.batchFrequency)
+	}
+	l.enqueue(c)
+}
+
+// ageCheckInterval is how often the chunk age is checked with WithMaxRecordAge.
+func (l *S3Logger) ageCheckInterval() time.Duration {
+	return max(l.maxRecordAge/10, 10*time.Millisecond)
+}
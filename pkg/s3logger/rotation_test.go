@@ -0,0 +1,93 @@
+package s3logger
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readBody(t *testing.T, rs *s3.PutObjectInput) string {
+	t.Helper()
+	reader, err := GzipCodec{}.NewReader(rs.Body)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRotateOnRecords(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 10)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithMaxRecords(3))
+	require.NoError(t, err)
+
+	for i := 0; i < 7; i++ {
+		require.NoError(t, l.Write([]byte("record\n")))
+	}
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, strings.Repeat("record\n", 3), readBody(t, rs))
+	rs = (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, strings.Repeat("record\n", 3), readBody(t, rs))
+
+	l.Sync()
+	rs = (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "record\n", readBody(t, rs))
+	assert.Empty(t, client.debugChan)
+}
+
+func TestRotateOnUncompressedSize(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 100)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithMaxUncompressedSize(1000))
+	require.NoError(t, err)
+
+	line := strings.Repeat("a", 99) + "\n"
+	for i := 0; i < 25; i++ {
+		require.NoError(t, l.Write([]byte(line)))
+	}
+	for i := 0; i < 2; i++ {
+		rs := (<-client.debugChan).(*s3.PutObjectInput)
+		assert.Equal(t, strings.Repeat(line, 11), readBody(t, rs))
+	}
+	assert.Empty(t, client.debugChan)
+}
+
+func TestRotateOnceAfterCrossingThreshold(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 100)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithMaxFileSize(100))
+	require.NoError(t, err)
+
+	for i := 0; i < 2_000; i++ {
+		require.NoError(t, l.Write([]byte(strings.Repeat("b", 10)+"\n")))
+	}
+	require.NoError(t, l.Close(t.Context()))
+
+	var total int
+	for len(client.debugChan) > 0 {
+		rs := (<-client.debugChan).(*s3.PutObjectInput)
+		total += len(readBody(t, rs))
+	}
+	assert.Equal(t, 2_000*11, total)
+}
+
+func TestRotateOnRecordAge(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithMaxRecordAge(50*time.Millisecond))
+	require.NoError(t, err)
+
+	start := time.Now()
+	require.NoError(t, l.Write([]byte("old record\n")))
+
+	select {
+	case v := <-client.debugChan:
+		assert.Equal(t, "old record\n", readBody(t, v.(*s3.PutObjectInput)))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	case <-time.After(2 * time.Second):
+		t.Fatal("chunk was not rotated")
+	}
+	require.NoError(t, l.Close(t.Context()))
+}
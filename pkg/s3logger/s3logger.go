@@ -2,21 +2,30 @@ package s3logger
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// ErrClosed is returned by writes to a closed logger.
+var ErrClosed = errors.New("s3logger: logger is closed")
+
 type S3Client interface {
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
 	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
 }
 
 type S3Logger struct {
@@ -24,52 +33,266 @@ type S3Logger struct {
 	prefix         string
 	fileID         string
 	service        S3Client
+	sink           Sink
+	customSink     bool
 	batchFrequency time.Duration
 	buffer         *bytes.Buffer
-	gzWriter       *gzip.Writer
+	codec          Codec
+	encoder        io.WriteCloser
 	mutex          sync.Mutex
 	maxFileSize    uint
 	ticker         *time.Ticker
+	spoolDir       string
+	spoolSignal    chan struct{}
+	spoolCancel    context.CancelFunc
+	spoolStopped   chan struct{}
+	spoolRetry     RetryPolicy
+	retryPolicy    RetryPolicy
+	uploadTimeout  time.Duration
+	onUploadError  UploadErrorHandler
+	closed         atomic.Bool
+	done           chan struct{}
+	wg             sync.WaitGroup
+	errMutex       sync.Mutex
+	errs           []error
+	keyBuilder     KeyBuilder
+	keyLocation    *time.Location
+	now            func() time.Time
+	serviceName    string
+	host           string
+	partSize       uint
+	multipart      *multipartUpload
+
+	maxUncompressedSize uint
+	maxRecords          uint
+	maxRecordAge        time.Duration
+	records             uint
+	uncompressedSize    uint
+	oldestRecord        time.Time
+	newestRecord        time.Time
+
+	uploadConcurrency int
+	queue             []*chunk
+	// enqueued numbers the queued chunks, uploading holds the numbers of
+	// the chunks being uploaded.
+	enqueued      uint64
+	uploading     map[uint64]struct{}
+	cond          *sync.Cond
+	inFlightBytes uint
+	// protectedBytes is the size of chunk protectedSeq while it is in
+	// flight, see rotateAlone.
+	protectedBytes   uint
+	protectedSeq     uint64
+	maxInFlightBytes uint
+	overflowPolicy   OverflowPolicy
+	droppedRecords   uint64
+	droppedChunks    uint64
+	delimiter        []byte
+	sampler          *Sampler
+	redactor         *Redactor
+
+	sse          types.ServerSideEncryption
+	sseKMSKeyID  string
+	storageClass types.StorageClass
+	tagging      string
+	metadata     map[string]string
+	keyWrapper   KeyWrapper
+
+	observer Observer
+
+	bucketCheck BucketCheck
+	lazyStart   bool
+	ready       chan struct{}
+	startErr    error
+
+	// events are the observer callbacks queued with l.mutex held.
+	events []func(o Observer)
+
+	manifestMutex    sync.Mutex
+	manifests        map[time.Time]*manifestState
+	latestHour       time.Time
+	manifestInterval time.Duration
+}
+
+// Sync uploads the buffered records and waits for the rotated chunks queued
+// before. It returns the error of the upload joined with the errors of
+// background uploads since the last Sync. The chunk is handed to the
+// UploadErrorHandler if the upload failed. Chunks are spooled instead if a
+// spool dir is set.
+func (l *S3Logger) Sync() error {
+	return l.SyncContext(context.Background())
+}
+
+// SyncContext is Sync bounded by ctx.
+func (l *S3Logger) SyncContext(ctx context.Context) error {
+	l.mutex.Lock()
+	queued := l.enqueued
+	l.unlock()
+	err := l.sync(ctx)
+	return errors.Join(err, l.waitUploaded(ctx, queued), l.takeErrors())
 }
 
-func (l *S3Logger) Sync() {
+func (l *S3Logger) sync(ctx context.Context) error {
 	l.mutex.Lock()
-	var b *bytes.Buffer
-	l.gzWriter.Close()
-	b, l.buffer = l.buffer, &bytes.Buffer{}
-	l.gzWriter = gzip.NewWriter(l.buffer)
-	l.mutex.Unlock()
-	if len(b.Bytes()) < 1 {
+	c := l.cut()
+	l.unlock()
+	if c == nil {
+		return nil
+	}
+	return l.flush(ctx, c)
+}
+
+// flush uploads a chunk that was cut from the logger.
+func (l *S3Logger) flush(ctx context.Context, c *chunk) error {
+	if c.lastPart != nil {
+		return l.completeMultipart(ctx, c.lastPart, c.info)
+	}
+	if c.buffer.Len() < 1 {
+		return nil
+	}
+	data := c.buffer.Bytes()
+	info := c.info
+	info.Time = l.now()
+	key := l.key(info.Time)
+	l.manifestChunkStarted(info.Time)
+	// a chunk that could not be spooled is uploaded right away, the spool
+	// error is returned either way
+	var spoolErr error
+	if l.spoolDir != "" {
+		spoolErr = l.spool(key, data, info)
+		if spoolErr == nil {
+			return nil
+		}
+		spoolErr = fmt.Errorf("could not spool chunk %s: %w", key, spoolErr)
+	}
+	entry, err := l.upload(ctx, key, data, info)
+	if err != nil {
+		l.deadLetter(key, data, err)
+		l.observer.Dropped(DropEvent{Reason: DropUploadFailed, Records: uint64(info.Records)})
+		l.manifestChunkFailed(info.Time)
+		return errors.Join(spoolErr, err)
+	}
+	return errors.Join(spoolErr, l.manifestChunkUploaded(ctx, info.Time, entry))
+}
+
+// backgroundFlush flushes on behalf of the ticker or a rotation.
+func (l *S3Logger) backgroundFlush(c *chunk) {
+	l.backgroundError(l.flush(context.Background(), c))
+}
+
+// maxBackgroundErrors limits the errors kept for the next Sync or Close.
+const maxBackgroundErrors = 100
+
+// backgroundError keeps an error of the background work for the next Sync or
+// Close. Errors beyond maxBackgroundErrors are discarded.
+func (l *S3Logger) backgroundError(err error) {
+	if err == nil {
 		return
 	}
-	now := time.Now()
-	ctx := context.Background()
-	_, err := l.service.PutObject(ctx, &s3.PutObjectInput{
-		Body:   bytes.NewReader(b.Bytes()),
-		Bucket: aws.String(l.bucket),
-		Key:    aws.String(fmt.Sprintf("%s%s/%s-%d.gz", l.prefix, now.Format("2006/01/02/15"), l.fileID, now.UnixMicro())),
-	})
+	l.errMutex.Lock()
+	defer l.errMutex.Unlock()
+	if len(l.errs) < maxBackgroundErrors {
+		l.errs = append(l.errs, err)
+	}
+}
+
+// takeErrors returns and forgets the errors of the background work.
+func (l *S3Logger) takeErrors() error {
+	l.errMutex.Lock()
+	defer l.errMutex.Unlock()
+	err := errors.Join(l.errs...)
+	l.errs = nil
+	return err
+}
+
+// upload puts the chunk to S3 or the sink, retrying according to the retry
+// policy. It returns the manifest entry of the uploaded object.
+func (l *S3Logger) upload(ctx context.Context, key string, data []byte, info chunkInfo) (ManifestChunk, error) {
+	err := l.waitReady(ctx)
 	if err != nil {
-		fmt.Println(err)
+		return ManifestChunk{}, err
+	}
+	return l.put(ctx, key, data, info)
+}
+
+func (l *S3Logger) deadLetter(key string, data []byte, err error) {
+	if l.onUploadError != nil {
+		l.onUploadError(key, data, err)
 	}
 }
 
+// resetEncoder starts a new compressed stream on l.buffer. New already
+// created an encoder with the same codec, so errors are not expected here.
+// If one occurs anyway, the chunk is written uncompressed and the error is
+// returned by the next Sync or Close.
+func (l *S3Logger) resetEncoder() {
+	encoder, err := l.codec.NewWriter(l.buffer)
+	if err != nil {
+		l.backgroundError(fmt.Errorf("could not create encoder: %w", err))
+		encoder = nopWriteCloser{l.buffer}
+	}
+	l.encoder = encoder
+}
+
 func (l *S3Logger) Write(p []byte) error {
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
-	_, err := l.gzWriter.Write(p)
+	return l.WriteContext(context.Background(), p)
+}
+
+// WriteContext is Write, but stops waiting for in-flight uploads with
+// OverflowBlock once ctx is done.
+func (l *S3Logger) WriteContext(ctx context.Context, p []byte) error {
+	if !l.sample(p) {
+		return nil
+	}
+	return l.write(ctx, p, true)
+}
+
+// write writes a record to the current chunk. Without wait, a record that
+// would block with OverflowBlock is dropped instead.
+func (l *S3Logger) write(ctx context.Context, p []byte, wait bool) error {
+	err := ctx.Err()
 	if err != nil {
 		return err
 	}
-	if uint(l.buffer.Len()) > l.maxFileSize {
-		go func() {
-			if l.batchFrequency > 0 {
-				l.ticker.Reset(l.batchFrequency)
-			}
-			l.Sync()
-		}()
+	l.mutex.Lock()
+	part, err := l.add(ctx, p, wait)
+	l.unlock()
+	if part != nil {
+		// hand the part over without blocking other writers
+		part.send()
 	}
-	return nil
+	return err
+}
+
+// add writes a record to the current chunk. It must be called with l.mutex
+// held and returns the part cut from a multipart upload, if any.
+func (l *S3Logger) add(ctx context.Context, p []byte, wait bool) (*part, error) {
+	if l.closed.Load() {
+		return nil, ErrClosed
+	}
+	ok, err := l.admit(ctx, wait)
+	if !ok {
+		return nil, err
+	}
+	_, err = l.encoder.Write(p)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if l.records == 0 {
+		l.oldestRecord = now
+	}
+	l.newestRecord = now
+	l.records++
+	l.uncompressedSize += uint(len(p))
+	var part *part
+	if l.partSize > 0 && uint(l.buffer.Len()) >= l.partSize {
+		part = l.cutPart()
+	}
+	if l.rotationDue(now) {
+		l.rotate()
+	}
+	return part, nil
 }
 
 type Option func(l *S3Logger) error
@@ -103,7 +326,6 @@ func WithMaxFileSize(size uint) Option {
 }
 
 func New(bucket string, service S3Client, opts ...Option) (*S3Logger, error) {
-	buffer := &bytes.Buffer{}
 	id, err := uuid.NewUUID()
 	if err != nil {
 		return nil, err
@@ -111,34 +333,180 @@ func New(bucket string, service S3Client, opts ...Option) (*S3Logger, error) {
 	l := &S3Logger{
 		bucket:         bucket,
 		service:        service,
-		buffer:         buffer,
+		buffer:         &bytes.Buffer{},
 		fileID:         id.String(),
-		gzWriter:       gzip.NewWriter(buffer),
+		codec:          GzipCodec{},
 		maxFileSize:    5_000_000,
 		batchFrequency: 1 * time.Minute,
+		retryPolicy:    DefaultRetryPolicy,
+		spoolRetry:     defaultSpoolRetry,
+		done:           make(chan struct{}),
+		keyBuilder:     DefaultKeyLayout,
+		keyLocation:    time.Local,
+		now:            time.Now,
+		host:           defaultHost(),
+
+		manifestInterval:  defaultManifestInterval,
+		uploadConcurrency: 4,
+		uploading:         map[uint64]struct{}{},
+		delimiter:         []byte("\n"),
+		observer:          NopObserver{},
 	}
+	l.cond = sync.NewCond(&l.mutex)
 	for _, opt := range opts {
 		err = opt(l)
 		if err != nil {
-			return nil, fmt.Errorf("could not apply option: %e", err)
+			return nil, fmt.Errorf("could not apply option: %w", err)
 		}
 	}
-	ctx := context.Background()
-	_, err = l.service.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &l.bucket})
+	if l.partSize > 0 && l.spoolDir != "" {
+		return nil, errors.New("multipart upload cannot be combined with a spool dir")
+	}
+	if l.partSize > 0 && l.keyWrapper != nil {
+		return nil, errors.New("multipart upload cannot be combined with client-side encryption")
+	}
+	if l.partSize > 0 && isParquet(l.codec) {
+		return nil, errors.New("multipart upload cannot be combined with the parquet codec")
+	}
+	if c, ok := l.codec.(ParquetCodec); ok {
+		l.codec = c.forLogger(l.delimiter)
+	}
+	if l.manifests != nil {
+		err = l.validateManifestKey()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l.customSink {
+		err = l.validateSink()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		l.sink = l.s3Sink()
+	}
+	if l.overflowPolicy == OverflowSpillToDisk && l.spoolDir == "" {
+		return nil, errors.New("spilling to disk requires a spool dir")
+	}
+	l.encoder, err = l.codec.NewWriter(l.buffer)
 	if err != nil {
-		return nil, fmt.Errorf("bucket does not exist: %e", err)
+		return nil, fmt.Errorf("could not create encoder: %w", err)
+	}
+	if l.lazyStart {
+		l.startLazy()
+	} else {
+		err = l.checkBucket(context.Background())
+		if err != nil {
+			return nil, err
+		}
 	}
+	if l.spoolDir != "" {
+		err = l.openSpool()
+		if err != nil {
+			return nil, fmt.Errorf("could not open spool dir: %w", err)
+		}
+	}
+	l.startUploaders()
 	if l.batchFrequency > 0 {
 		l.ticker = time.NewTicker(l.batchFrequency)
+	}
+	if l.batchFrequency > 0 || l.maxRecordAge > 0 || l.sampler != nil && l.sampler.policy.SummaryInterval > 0 {
 		l.start()
 	}
 	return l, nil
 }
 
 func (l *S3Logger) start() {
+	var tick, ageTick <-chan time.Time
+	if l.ticker != nil {
+		tick = l.ticker.C
+	}
+	var ageTicker, summaryTicker *time.Ticker
+	if l.maxRecordAge > 0 {
+		ageTicker = time.NewTicker(l.ageCheckInterval())
+		ageTick = ageTicker.C
+	}
+	var summaryTick <-chan time.Time
+	if l.sampler != nil && l.sampler.policy.SummaryInterval > 0 {
+		summaryTicker = time.NewTicker(l.sampler.policy.SummaryInterval)
+		summaryTick = summaryTicker.C
+	}
+	l.wg.Add(1)
 	go func() {
-		for range l.ticker.C {
-			l.Sync()
+		defer l.wg.Done()
+		if ageTicker != nil {
+			defer ageTicker.Stop()
+		}
+		if summaryTicker != nil {
+			defer summaryTicker.Stop()
+		}
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-tick:
+				l.mutex.Lock()
+				l.rotate()
+				l.unlock()
+			case now := <-ageTick:
+				l.mutex.Lock()
+				if l.rotationDue(now) {
+					l.rotate()
+				}
+				l.unlock()
+			case now := <-summaryTick:
+				l.writeSamplingSummary(now)
+			}
 		}
 	}()
 }
+
+// Close stops the batch ticker, waits for in-flight uploads and flushes the
+// remaining buffer, all bounded by ctx. It returns the errors of the uploads
+// it waited for and of the final flush. Writes after Close fail with ErrClosed.
+func (l *S3Logger) Close(ctx context.Context) error {
+	l.mutex.Lock()
+	if !l.closed.CompareAndSwap(false, true) {
+		l.unlock()
+		return ErrClosed
+	}
+	// wake up blocked writers and idle upload workers
+	l.cond.Broadcast()
+	l.unlock()
+	if l.ticker != nil {
+		l.ticker.Stop()
+	}
+	close(l.done)
+
+	var errs []error
+	waited := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+	l.mutex.Lock()
+	queue := l.queue
+	l.queue = nil
+	for _, c := range queue {
+		l.uploading[c.seq] = struct{}{}
+	}
+	l.unlock()
+	for _, c := range queue {
+		errs = append(errs, l.flush(ctx, c))
+		l.uploaded(c)
+	}
+	errs = append(errs, l.sync(ctx))
+	if l.spoolDir != "" {
+		l.spoolCancel()
+		<-l.spoolStopped
+		errs = append(errs, l.drainSpool(ctx))
+	}
+	errs = append(errs, l.closeManifests(ctx))
+	errs = append(errs, l.takeErrors())
+	return errors.Join(errs...)
+}
@@ -2,30 +2,55 @@ package s3logger
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type s3MockClient struct {
 	debugChan chan interface{}
+	putErr    error
+	headErr   error
 }
 
 func (c s3MockClient) HeadBucket(context.Context, *s3.HeadBucketInput, ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
-	return nil, nil
+	return nil, c.headErr
 }
 
 func (c s3MockClient) PutObject(_ context.Context, params *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	if c.putErr != nil {
+		return nil, c.putErr
+	}
 	if c.debugChan != nil {
 		c.debugChan <- params
 	}
 	return nil, nil
 }
 
+func (c s3MockClient) CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (c s3MockClient) UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+}
+
+func (c s3MockClient) CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (c s3MockClient) AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
 func TestNewS3Logger(t *testing.T) {
 	l, err := New("foundry-curation-test", s3MockClient{}, WithoutBatchFrequency())
 	assert.Nil(t, err)
@@ -66,12 +91,98 @@ func TestSyncAfter50M(t *testing.T) {
 	assert.Len(t, client.debugChan, 0)
 
 	messageBytes := []byte("' !\"#$%&\\'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\\\]^_`abcdefghijklmnopqrstuvwxyz{|}~'")
-	for i := 0; uint(l.buffer.Len()) < l.maxFileSize; i++ {
+	var rs *s3.PutObjectInput
+	for rs == nil {
 		l.Write(messageBytes)
+		select {
+		case v := <-client.debugChan:
+			rs = v.(*s3.PutObjectInput)
+		default:
+		}
 	}
-	rs := (<-client.debugChan).(*s3.PutObjectInput)
 	data, err := io.ReadAll(rs.Body)
 	assert.Nil(t, err)
 	assert.GreaterOrEqual(t, uint(len(data)), l.maxFileSize)
 	assert.LessOrEqual(t, uint(len(data)), uint(1.1*float64(l.maxFileSize)))
 }
+
+func TestSyncReturnsUploadError(t *testing.T) {
+	uploadErr := errors.New("access denied")
+	var deadLetters int
+	l, err := New("foundry-curation-test", s3MockClient{putErr: uploadErr}, WithoutBatchFrequency(),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}), WithOnUploadError(func(string, []byte, error) { deadLetters++ }))
+	require.NoError(t, err)
+
+	assert.NoError(t, l.Sync())
+	require.NoError(t, l.Write([]byte("lost line\n")))
+	assert.ErrorIs(t, l.Sync(), uploadErr)
+	assert.Equal(t, 1, deadLetters)
+}
+
+func TestSyncContext(t *testing.T) {
+	l, err := New("foundry-curation-test", blockingS3Client{}, WithoutBatchFrequency(),
+		WithOnUploadError(func(string, []byte, error) {}))
+	require.NoError(t, err)
+	require.NoError(t, l.Write([]byte("stuck\n")))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, l.SyncContext(ctx), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.WriteContext(canceled, []byte("late\n")), context.Canceled)
+}
+
+// slowSink stores the objects after a delay.
+type slowSink struct {
+	memorySink
+	delay time.Duration
+}
+
+func (s *slowSink) Put(ctx context.Context, o Object) error {
+	time.Sleep(s.delay)
+	return s.memorySink.Put(ctx, o)
+}
+
+func (s *slowSink) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.objects)
+}
+
+func TestSyncWaitsForQueuedChunks(t *testing.T) {
+	sink := &slowSink{delay: 200 * time.Millisecond}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithMaxRecords(2), WithUploadConcurrency(1))
+	require.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, l.WriteRecord([]byte("record")))
+	}
+	require.NoError(t, l.Sync())
+	assert.Equal(t, 3, sink.count())
+
+	require.NoError(t, l.WriteRecord([]byte("record")))
+	require.NoError(t, l.WriteRecord([]byte("record")))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.SyncContext(ctx), context.DeadlineExceeded)
+	require.NoError(t, l.Close(context.Background()))
+	assert.Equal(t, 4, sink.count())
+}
+
+func TestSyncReturnsBackgroundErrors(t *testing.T) {
+	uploadErr := errors.New("unavailable")
+	sink := &memorySink{errs: []error{uploadErr}}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithMaxRecords(1), WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	require.NoError(t, err)
+	require.NoError(t, l.WriteRecord([]byte("lost")))
+	assert.ErrorIs(t, l.Sync(), uploadErr)
+	assert.NoError(t, l.Sync())
+
+	for i := 0; i < maxBackgroundErrors+1; i++ {
+		l.backgroundError(uploadErr)
+	}
+	assert.Len(t, l.takeErrors().(interface{ Unwrap() []error }).Unwrap(), maxBackgroundErrors)
+}
@@ -0,0 +1,179 @@
+package s3logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// SamplingPolicy limits noisy log sources. Within every Tick the first
+// First records of a key are kept, afterwards only every Thereafter-th
+// (none if Thereafter is zero). RatePerSecond additionally caps the kept
+// records of all keys, zero disables the cap. If SummaryInterval is set, a
+// record with the number of suppressed records is written periodically.
+type SamplingPolicy struct {
+	Tick            time.Duration
+	First           int
+	Thereafter      int
+	RatePerSecond   float64
+	SummaryInterval time.Duration
+	// Key groups records for sampling, nil samples all records as one group.
+	Key func(record []byte) string
+}
+
+// Sampler decides which records are kept according to a SamplingPolicy. It
+// is safe for concurrent use.
+type Sampler struct {
+	policy    SamplingPolicy
+	mutex     sync.Mutex
+	tickStart time.Time
+	counts    map[string]int
+	tokens    float64
+	refilled  time.Time
+
+	sampled, rateLimited           uint64
+	totalSampled, totalRateLimited uint64
+	lastSummary                    time.Time
+}
+
+// SamplingSummary counts the records suppressed since the previous summary.
+type SamplingSummary struct {
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level"`
+	Msg         string    `json:"msg"`
+	Sampled     uint64    `json:"sampled"`
+	RateLimited uint64    `json:"rate_limited"`
+}
+
+func NewSampler(p SamplingPolicy) (*Sampler, error) {
+	if p.Tick <= 0 && p.RatePerSecond <= 0 {
+		return nil, errors.New("sampling needs a tick or a rate")
+	}
+	if p.First < 0 || p.Thereafter < 0 || p.RatePerSecond < 0 {
+		return nil, errors.New("sampling parameters must not be negative")
+	}
+	now := time.Now()
+	return &Sampler{
+		policy:      p,
+		counts:      map[string]int{},
+		tokens:      max(p.RatePerSecond, 1),
+		refilled:    now,
+		lastSummary: now,
+	}, nil
+}
+
+// Allow reports whether a record with the given key is kept.
+func (s *Sampler) Allow(key string, now time.Time) bool {
+	_, ok := s.allow(key, now)
+	return ok
+}
+
+// allow is Allow returning why a record is dropped.
+func (s *Sampler) allow(key string, now time.Time) (DropReason, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.policy.Tick > 0 {
+		if now.Sub(s.tickStart) >= s.policy.Tick {
+			s.tickStart = now
+			clear(s.counts)
+		}
+		s.counts[key]++
+		n := s.counts[key]
+		if n > s.policy.First && (s.policy.Thereafter == 0 || (n-s.policy.First)%s.policy.Thereafter != 0) {
+			s.sampled++
+			s.totalSampled++
+			return DropSampled, false
+		}
+	}
+	if s.policy.RatePerSecond > 0 {
+		burst := max(s.policy.RatePerSecond, 1)
+		s.tokens = min(burst, s.tokens+now.Sub(s.refilled).Seconds()*s.policy.RatePerSecond)
+		s.refilled = now
+		if s.tokens < 1 {
+			s.rateLimited++
+			s.totalRateLimited++
+			return DropRateLimited, false
+		}
+		s.tokens--
+	}
+	return "", true
+}
+
+// Summary returns the records suppressed since the last summary if the
+// summary interval has passed and anything was suppressed.
+func (s *Sampler) Summary(now time.Time) (SamplingSummary, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.policy.SummaryInterval <= 0 || now.Sub(s.lastSummary) < s.policy.SummaryInterval {
+		return SamplingSummary{}, false
+	}
+	s.lastSummary = now
+	if s.sampled == 0 && s.rateLimited == 0 {
+		return SamplingSummary{}, false
+	}
+	summary := SamplingSummary{
+		Time:        now,
+		Level:       "INFO",
+		Msg:         "log records suppressed",
+		Sampled:     s.sampled,
+		RateLimited: s.rateLimited,
+	}
+	s.sampled, s.rateLimited = 0, 0
+	return summary, true
+}
+
+// untilSummary returns the time left until the summary interval has passed.
+func (s *Sampler) untilSummary(now time.Time) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return max(0, s.lastSummary.Add(s.policy.SummaryInterval).Sub(now))
+}
+
+// Suppressed returns the total number of sampled and rate limited records.
+func (s *Sampler) Suppressed() (sampled, rateLimited uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.totalSampled, s.totalRateLimited
+}
+
+// WithSampling drops records written to the logger according to p.
+func WithSampling(p SamplingPolicy) Option {
+	return func(l *S3Logger) error {
+		s, err := NewSampler(p)
+		if err != nil {
+			return err
+		}
+		l.sampler = s
+		return nil
+	}
+}
+
+func (l *S3Logger) sample(p []byte) bool {
+	if l.sampler == nil {
+		return true
+	}
+	var key string
+	if l.sampler.policy.Key != nil {
+		key = l.sampler.policy.Key(p)
+	}
+	reason, ok := l.sampler.allow(key, time.Now())
+	if !ok {
+		l.observer.Dropped(DropEvent{Reason: reason, Records: 1})
+	}
+	return ok
+}
+
+func (l *S3Logger) writeSamplingSummary(now time.Time) {
+	summary, ok := l.sampler.Summary(now)
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+	// the ticker goroutine must not block on OverflowBlock
+	_ = l.write(context.Background(), append(data, l.delimiter...), false)
+}
@@ -0,0 +1,175 @@
+package s3logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplerFirstThereafter(t *testing.T) {
+	s, err := NewSampler(SamplingPolicy{Tick: time.Second, First: 3, Thereafter: 5})
+	require.NoError(t, err)
+
+	now := time.Now()
+	var kept int
+	for i := 0; i < 23; i++ {
+		if s.Allow("key", now) {
+			kept++
+		}
+	}
+	// 3 first, then records 8, 13, 18, 23
+	assert.Equal(t, 7, kept)
+	assert.True(t, s.Allow("other", now))
+
+	// a new tick starts over
+	assert.True(t, s.Allow("key", now.Add(time.Second)))
+	sampled, rateLimited := s.Suppressed()
+	assert.Equal(t, uint64(16), sampled)
+	assert.Zero(t, rateLimited)
+}
+
+func TestSamplerRateLimit(t *testing.T) {
+	s, err := NewSampler(SamplingPolicy{RatePerSecond: 10})
+	require.NoError(t, err)
+
+	now := time.Now()
+	var kept int
+	for i := 0; i < 100; i++ {
+		if s.Allow("", now) {
+			kept++
+		}
+	}
+	assert.Equal(t, 10, kept)
+	assert.True(t, s.Allow("", now.Add(100*time.Millisecond)))
+	assert.False(t, s.Allow("", now.Add(100*time.Millisecond)))
+}
+
+func TestSamplerValidation(t *testing.T) {
+	_, err := NewSampler(SamplingPolicy{})
+	assert.Error(t, err)
+	_, err = NewSampler(SamplingPolicy{Tick: time.Second, First: -1})
+	assert.Error(t, err)
+}
+
+func TestS3LoggerSampling(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithSampling(SamplingPolicy{
+		Tick:            time.Hour,
+		First:           2,
+		SummaryInterval: 100 * time.Millisecond,
+		Key:             func(record []byte) string { return string(bytes.Fields(record)[0]) },
+	}))
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, l.WriteRecord([]byte("noisy request")))
+		require.NoError(t, l.WriteRecord([]byte("quiet request")))
+	}
+	assert.Equal(t, uint64(16), l.Stats().SampledRecords)
+	assert.Eventually(t, func() bool {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		return l.records == 5
+	}, time.Second, 5*time.Millisecond)
+	require.NoError(t, l.Close(t.Context()))
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	lines := strings.Split(strings.TrimSpace(readBody(t, rs)), "\n")
+	require.Len(t, lines, 5)
+	var summary SamplingSummary
+	require.NoError(t, json.Unmarshal([]byte(lines[4]), &summary))
+	assert.Equal(t, uint64(16), summary.Sampled)
+	assert.Equal(t, "log records suppressed", summary.Msg)
+}
+
+func TestSlogHandlerSampling(t *testing.T) {
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithCodec(NoneCodec{}))
+	require.NoError(t, err)
+	var stdout bytes.Buffer
+	h, err := NewSlogHandler(SlogHandlerOptions{
+		Default:  l,
+		Also:     []slog.Handler{slog.NewJSONHandler(&stdout, nil)},
+		Sampling: &SamplingPolicy{Tick: time.Hour, First: 1, Thereafter: 3, SummaryInterval: 50 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	logger := slog.New(h).With(slog.String("component", "test"))
+
+	for i := 0; i < 7; i++ {
+		logger.Info("same message", slog.Int("i", i))
+	}
+	logger.Warn("same message")
+	assert.Equal(t, 8, strings.Count(stdout.String(), "\n"))
+
+	var records []map[string]any
+	assert.Eventually(t, func() bool {
+		l.Sync()
+		sink.mutex.Lock()
+		defer sink.mutex.Unlock()
+		records = nil
+		for _, o := range sink.objects {
+			split, err := o.Split()
+			require.NoError(t, err)
+			for _, data := range split {
+				var record map[string]any
+				require.NoError(t, json.Unmarshal(data, &record))
+				records = append(records, record)
+			}
+		}
+		return len(records) == 5
+	}, time.Second, 10*time.Millisecond)
+
+	var messages []string
+	for _, r := range records {
+		messages = append(messages, r["msg"].(string))
+	}
+	// records 0, 3 and 6 are kept, the warning has a key of its own and the
+	// summary is written by the timer without waiting for another record
+	assert.Equal(t, []string{
+		"same message",
+		"same message",
+		"same message",
+		"same message",
+		"log records suppressed",
+	}, messages)
+	assert.Equal(t, float64(4), records[4]["sampled"])
+	assert.NotContains(t, records[4], "component")
+	assert.Equal(t, "test", records[0]["component"])
+	assert.Equal(t, 8, strings.Count(stdout.String(), "\n"))
+}
+
+func TestSlogHandlerCloseStopsSummaryTimer(t *testing.T) {
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithCodec(NoneCodec{}))
+	require.NoError(t, err)
+	h, err := NewSlogHandler(SlogHandlerOptions{
+		Default:  l,
+		Sampling: &SamplingPolicy{Tick: time.Hour, First: 1, SummaryInterval: 50 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	logger := slog.New(h).With(slog.String("component", "test"))
+
+	for i := 0; i < 3; i++ {
+		logger.Info("same message")
+	}
+	assert.NotNil(t, h.summaryTimer)
+	h.Close()
+	assert.Nil(t, h.summaryTimer)
+	logger.Info("same message")
+	assert.Nil(t, h.summaryTimer)
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, l.Close(t.Context()))
+	require.Len(t, sink.objects, 1)
+	split, err := sink.objects[0].Split()
+	require.NoError(t, err)
+	assert.Len(t, split, 1)
+}
@@ -0,0 +1,133 @@
+package s3logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardedLogger spreads writes over independent S3Loggers, each with its own
+// buffer, encoder and lock, to avoid contention between many writing
+// goroutines. Shard i uploads objects with the file ID suffix -i and spools
+// to the subdirectory i of the spool dir. Limits like WithMaxInFlightBytes
+// and WithSampling apply per shard.
+type ShardedLogger struct {
+	shards []*S3Logger
+	next   atomic.Uint64
+}
+
+// NewSharded creates n loggers with the same options.
+func NewSharded(bucket string, service S3Client, n int, opts ...Option) (*ShardedLogger, error) {
+	if n < 1 {
+		return nil, errors.New("at least one shard is required")
+	}
+	s := &ShardedLogger{}
+	var fileID string
+	for i := 0; i < n; i++ {
+		l, err := New(bucket, service, append(slices.Clip(opts), withShard(i, &fileID))...)
+		if err != nil {
+			_ = s.Close(context.Background())
+			return nil, fmt.Errorf("could not create shard %d: %w", i, err)
+		}
+		s.shards = append(s.shards, l)
+	}
+	return s, nil
+}
+
+// withShard makes the logger shard i of a ShardedLogger. All shards share the
+// file ID of the first one.
+func withShard(i int, fileID *string) Option {
+	return func(l *S3Logger) error {
+		if *fileID == "" {
+			*fileID = l.fileID
+		}
+		l.fileID = *fileID + "-" + strconv.Itoa(i)
+		if l.spoolDir != "" {
+			l.spoolDir = filepath.Join(l.spoolDir, strconv.Itoa(i))
+		}
+		return nil
+	}
+}
+
+// Shard returns the next shard round-robin. A goroutine writing many records
+// may keep a shard for itself to write without any contention.
+func (s *ShardedLogger) Shard() *S3Logger {
+	return s.shards[(s.next.Add(1)-1)%uint64(len(s.shards))]
+}
+
+// Shards returns all shards.
+func (s *ShardedLogger) Shards() []*S3Logger {
+	return s.shards
+}
+
+func (s *ShardedLogger) Write(p []byte) error {
+	return s.Shard().Write(p)
+}
+
+func (s *ShardedLogger) WriteRecord(p []byte) error {
+	return s.Shard().WriteRecord(p)
+}
+
+func (s *ShardedLogger) WriteJSON(v any) error {
+	return s.Shard().WriteJSON(v)
+}
+
+func (s *ShardedLogger) WriteContext(ctx context.Context, p []byte) error {
+	return s.Shard().WriteContext(ctx, p)
+}
+
+// Sync uploads the buffers of all shards in parallel.
+func (s *ShardedLogger) Sync() error {
+	return s.SyncContext(context.Background())
+}
+
+// SyncContext is Sync bounded by ctx.
+func (s *ShardedLogger) SyncContext(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.shards))
+	for i, l := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = l.SyncContext(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Close closes all shards in parallel.
+func (s *ShardedLogger) Close(ctx context.Context) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(s.shards))
+	for i, l := range s.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = l.Close(ctx)
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Stats returns the sum of the Stats of all shards.
+func (s *ShardedLogger) Stats() Stats {
+	var sum Stats
+	for _, l := range s.shards {
+		st := l.Stats()
+		sum.BufferedBytes += st.BufferedBytes
+		sum.InFlightBytes += st.InFlightBytes
+		sum.QueuedChunks += st.QueuedChunks
+		sum.DroppedRecords += st.DroppedRecords
+		sum.DroppedChunks += st.DroppedChunks
+		sum.SampledRecords += st.SampledRecords
+		sum.RateLimitedRecords += st.RateLimitedRecords
+	}
+	return sum
+}
@@ -0,0 +1,158 @@
+package s3logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardedLogger(t *testing.T) {
+	client := newObjectsS3Client()
+	s, err := NewSharded("foundry-curation-test", client, 4, WithoutBatchFrequency(), WithCodec(NoneCodec{}))
+	require.NoError(t, err)
+	require.Len(t, s.Shards(), 4)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.NoError(t, s.WriteRecord([]byte(fmt.Sprintf("%d-%d", g, i))))
+			}
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, s.Close(context.Background()))
+
+	fileID := strings.TrimSuffix(s.Shards()[0].fileID, "-0")
+	var lines []string
+	for i, l := range s.Shards() {
+		assert.Equal(t, fmt.Sprintf("%s-%d", fileID, i), l.fileID)
+	}
+	require.Len(t, client.bodies, 4)
+	for key, body := range client.bodies {
+		assert.Contains(t, key, fileID+"-")
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+	}
+	assert.Len(t, lines, 1600)
+	assert.Zero(t, s.Stats().InFlightBytes)
+}
+
+func TestShardedLoggerRoundRobin(t *testing.T) {
+	s, err := NewSharded("foundry-curation-test", s3MockClient{}, 3, WithoutBatchFrequency())
+	require.NoError(t, err)
+	assert.Same(t, s.Shards()[0], s.Shard())
+	assert.Same(t, s.Shards()[1], s.Shard())
+	assert.Same(t, s.Shards()[2], s.Shard())
+	assert.Same(t, s.Shards()[0], s.Shard())
+}
+
+func TestShardedLoggerKeepsOptions(t *testing.T) {
+	opts := make([]Option, 1, 2)
+	opts[0] = WithoutBatchFrequency()
+	_, err := NewSharded("foundry-curation-test", s3MockClient{}, 2, opts...)
+	require.NoError(t, err)
+	// the spare capacity of the caller's slice is not written to
+	assert.Nil(t, opts[:2][1])
+}
+
+func TestShardedLoggerSpoolDirs(t *testing.T) {
+	dir := t.TempDir()
+	failing := s3MockClient{putErr: fmt.Errorf("s3 unavailable")}
+	s, err := NewSharded("foundry-curation-test", failing, 2, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+	require.NoError(t, s.Write([]byte("first\n")))
+	require.NoError(t, s.Write([]byte("second\n")))
+	s.Sync()
+
+	for i := 0; i < 2; i++ {
+		entries, err := os.ReadDir(filepath.Join(dir, fmt.Sprint(i)))
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	}
+}
+
+func TestShardedLoggerErrors(t *testing.T) {
+	_, err := NewSharded("foundry-curation-test", s3MockClient{}, 0)
+	assert.Error(t, err)
+	_, err = NewSharded("foundry-curation-test", s3MockClient{}, 2, WithMultipartUpload(1))
+	assert.ErrorContains(t, err, "could not create shard 0")
+}
+
+// benchmarkWriters is the number of goroutines writing concurrently.
+const benchmarkWriters = 16
+
+var benchmarkRecord = []byte(`{"time":"2024-03-01T10:00:00Z","level":"INFO","msg":"request served","path":"/api/items","status":200}` + "\n")
+
+type nopS3Client struct {
+	s3MockClient
+}
+
+func (nopS3Client) PutObject(context.Context, *s3.PutObjectInput, ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	return &s3.PutObjectOutput{}, nil
+}
+
+func benchmarkParallel(b *testing.B, write func([]byte) error) {
+	b.SetBytes(int64(len(benchmarkRecord)))
+	b.SetParallelism((benchmarkWriters + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := write(benchmarkRecord); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+func BenchmarkWriteSingle(b *testing.B) {
+	l, err := New("foundry-curation-test", nopS3Client{}, WithoutBatchFrequency())
+	require.NoError(b, err)
+	benchmarkParallel(b, l.Write)
+	b.StopTimer()
+	require.NoError(b, l.Close(context.Background()))
+}
+
+func BenchmarkWriteSharded(b *testing.B) {
+	for _, n := range []int{4, 16} {
+		b.Run(fmt.Sprintf("shards=%d", n), func(b *testing.B) {
+			s, err := NewSharded("foundry-curation-test", nopS3Client{}, n, WithoutBatchFrequency())
+			require.NoError(b, err)
+			benchmarkParallel(b, s.Write)
+			b.StopTimer()
+			require.NoError(b, s.Close(context.Background()))
+		})
+	}
+}
+
+// BenchmarkWriteShardPerGoroutine keeps one shard per writing goroutine.
+func BenchmarkWriteShardPerGoroutine(b *testing.B) {
+	s, err := NewSharded("foundry-curation-test", nopS3Client{}, benchmarkWriters, WithoutBatchFrequency())
+	require.NoError(b, err)
+	b.SetBytes(int64(len(benchmarkRecord)))
+	b.SetParallelism((benchmarkWriters + runtime.GOMAXPROCS(0) - 1) / runtime.GOMAXPROCS(0))
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		shard := s.Shard()
+		for pb.Next() {
+			if err := shard.Write(benchmarkRecord); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.StopTimer()
+	require.NoError(b, s.Close(context.Background()))
+}
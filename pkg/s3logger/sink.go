@@ -0,0 +1,228 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Object is a chunk handed to a Sink.
+type Object struct {
+	Key             string
+	Data            []byte
+	ContentType     string
+	ContentEncoding string
+	Metadata        map[string]string
+	// Codec compressed Data, Delimiter terminates every record.
+	Codec     Codec
+	Delimiter []byte
+	Records   uint
+	First     time.Time
+	Last      time.Time
+}
+
+// Split decompresses the object and returns its records without delimiter.
+func (o Object) Split() ([][]byte, error) {
+	r, err := o.Codec.NewReader(bytes.NewReader(o.Data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	records := bytes.SplitAfter(data, o.Delimiter)
+	if len(records[len(records)-1]) == 0 {
+		records = records[:len(records)-1]
+	}
+	for i, record := range records {
+		records[i] = bytes.TrimSuffix(record, o.Delimiter)
+	}
+	return records, nil
+}
+
+// Sink stores the chunks of a logger. Failed calls of Put are retried
+// according to the retry policy, so it should not retry itself.
+type Sink interface {
+	Put(ctx context.Context, o Object) error
+}
+
+// WithSink hands the chunks to sink instead of uploading them to the bucket,
+// the bucket is not checked. Multipart uploads, client-side encryption and
+// the S3 object options are not supported with a sink. Manifests are handed
+// to the sink like chunks, so they are not supported with CloudWatchLogsSink
+// and FirehoseSink, which split objects into records.
+func WithSink(sink Sink) Option {
+	return func(l *S3Logger) error {
+		if sink == nil {
+			return errors.New("sink must not be nil")
+		}
+		l.sink = sink
+		l.customSink = true
+		return nil
+	}
+}
+
+// NewWithSink creates a logger handing its chunks to sink.
+func NewWithSink(sink Sink, opts ...Option) (*S3Logger, error) {
+	return New("", nil, append([]Option{WithSink(sink)}, opts...)...)
+}
+
+// validateSink rejects options that only work with S3.
+func (l *S3Logger) validateSink() error {
+	switch {
+	case l.partSize > 0:
+		return errors.New("multipart upload cannot be combined with a sink")
+	case l.keyWrapper != nil:
+		return errors.New("client-side encryption cannot be combined with a sink")
+	case l.sse != "" || l.storageClass != "" || l.tagging != "":
+		return errors.New("S3 object options cannot be combined with a sink")
+	case l.manifests != nil && isRecordSink(l.sink):
+		return fmt.Errorf("manifests cannot be combined with %T", l.sink)
+	}
+	return nil
+}
+
+// isRecordSink reports whether sink splits objects into records, which breaks
+// manifests.
+func isRecordSink(sink Sink) bool {
+	switch sink.(type) {
+	case CloudWatchLogsSink, *CloudWatchLogsSink, FirehoseSink, *FirehoseSink:
+		return true
+	}
+	return false
+}
+
+// s3Sink returns the sink uploading to the bucket of the logger with its
+// object settings.
+func (l *S3Logger) s3Sink() S3Sink {
+	return S3Sink{
+		Client:               l.service,
+		Bucket:               l.bucket,
+		ServerSideEncryption: l.sse,
+		SSEKMSKeyID:          l.sseKMSKeyID,
+		StorageClass:         l.storageClass,
+		Tagging:              l.tagging,
+		Options:              l.s3Options(),
+	}
+}
+
+// put hands the chunk to the sink, retrying according to the retry policy.
+// The chunk is encrypted first if a key wrapper is configured.
+func (l *S3Logger) put(ctx context.Context, key string, data []byte, info chunkInfo) (ManifestChunk, error) {
+	o := Object{
+		Key:             key,
+		ContentType:     l.codec.ContentType(),
+		ContentEncoding: l.codec.ContentEncoding(),
+		Metadata:        l.objectMetadata(info),
+		Codec:           l.codec,
+		Delimiter:       l.delimiter,
+		Records:         info.Records,
+		First:           info.First,
+		Last:            info.Last,
+	}
+	if l.keyWrapper != nil {
+		var err error
+		data, err = encryptEnvelope(l.keyWrapper, o.Metadata, data)
+		if err != nil {
+			return ManifestChunk{}, err
+		}
+		o.ContentType, o.ContentEncoding = "application/octet-stream", ""
+	}
+	o.Data = data
+	op := OperationPutObject
+	if l.customSink {
+		op = OperationSinkPut
+	}
+	err := l.putObject(ctx, op, o)
+	if err != nil {
+		return ManifestChunk{}, err
+	}
+	sha256Sum, _ := checksums(data)
+	return ManifestChunk{
+		Key:            key,
+		Size:           int64(len(data)),
+		Records:        info.Records,
+		First:          info.First,
+		Last:           info.Last,
+		ChecksumSHA256: sha256Sum,
+	}, nil
+}
+
+// putObject hands o to the sink, retrying according to the retry policy.
+func (l *S3Logger) putObject(ctx context.Context, op UploadOperation, o Object) error {
+	return l.retryPolicy.do(ctx, l.observed(op, o.Key, len(o.Data), func(ctx context.Context) error {
+		return l.sink.Put(ctx, o)
+	}))
+}
+
+// S3PutClient is the part of the S3 API used by S3Sink.
+type S3PutClient interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Sink puts every chunk as object to a bucket. Loggers created with New
+// upload through an S3Sink with their object settings.
+type S3Sink struct {
+	Client               S3PutClient
+	Bucket               string
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
+	StorageClass         types.StorageClass
+	// Tagging is URL query encoded, e.g. "team=curation&env=prod".
+	Tagging string
+	// Options are passed to every request.
+	Options []func(*s3.Options)
+}
+
+func (s S3Sink) Put(ctx context.Context, o Object) error {
+	sha256Sum, md5Sum := checksums(o.Data)
+	input := &s3.PutObjectInput{
+		Body:           bytes.NewReader(o.Data),
+		Bucket:         aws.String(s.Bucket),
+		Key:            aws.String(o.Key),
+		ContentType:    aws.String(o.ContentType),
+		ContentLength:  aws.Int64(int64(len(o.Data))),
+		ChecksumSHA256: aws.String(sha256Sum),
+		ContentMD5:     aws.String(md5Sum),
+		Metadata:       o.Metadata,
+
+		ServerSideEncryption: s.ServerSideEncryption,
+		StorageClass:         s.StorageClass,
+	}
+	if o.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(o.ContentEncoding)
+	}
+	if s.SSEKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.SSEKMSKeyID)
+	}
+	if s.Tagging != "" {
+		input.Tagging = aws.String(s.Tagging)
+	}
+	_, err := s.Client.PutObject(ctx, input, s.Options...)
+	return err
+}
+
+// FileSink writes every chunk to a file below Dir, named by its key.
+type FileSink struct {
+	Dir string
+}
+
+func (s FileSink) Put(_ context.Context, o Object) error {
+	name := filepath.Join(s.Dir, filepath.FromSlash(o.Key))
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(name, o.Data)
+}
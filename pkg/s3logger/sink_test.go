@@ -0,0 +1,202 @@
+package s3logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memorySink struct {
+	mutex   sync.Mutex
+	objects []Object
+	errs    []error
+}
+
+func (s *memorySink) Put(_ context.Context, o Object) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	s.objects = append(s.objects, o)
+	return nil
+}
+
+func TestNewWithSink(t *testing.T) {
+	sink := &memorySink{errs: []error{errors.New("unavailable")}}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithPrefix("logs/"), WithCodec(NoneCodec{}), WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+	require.NoError(t, err)
+
+	require.NoError(t, l.WriteRecord([]byte("first")))
+	require.NoError(t, l.WriteRecord([]byte("second")))
+	l.Sync()
+
+	require.Len(t, sink.objects, 1)
+	o := sink.objects[0]
+	assert.Contains(t, o.Key, "logs/")
+	assert.Equal(t, ".ndjson", filepath.Ext(o.Key))
+	assert.Equal(t, "first\nsecond\n", string(o.Data))
+	assert.Equal(t, "application/x-ndjson", o.ContentType)
+	assert.EqualValues(t, 2, o.Records)
+	assert.Equal(t, "2", o.Metadata[MetadataRecordCount])
+	records, err := o.Split()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("first"), []byte("second")}, records)
+}
+
+func TestNewWithSinkErrors(t *testing.T) {
+	sink := &memorySink{}
+	keyWrapper, err := NewAESKeyWrapper(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+	for _, opt := range []Option{
+		WithMultipartUpload(5 << 20),
+		WithClientSideEncryption(keyWrapper),
+		WithStorageClass(types.StorageClassStandardIa),
+	} {
+		_, err = NewWithSink(sink, WithoutBatchFrequency(), opt)
+		assert.Error(t, err)
+	}
+	_, err = NewWithSink(nil)
+	assert.Error(t, err)
+}
+
+func TestSinkManifest(t *testing.T) {
+	sink := &memorySink{}
+	l, err := NewWithSink(sink, WithoutBatchFrequency(), WithManifest())
+	require.NoError(t, err)
+	require.NoError(t, l.WriteRecord([]byte("hello")))
+	require.NoError(t, l.Close(context.Background()))
+
+	require.Len(t, sink.objects, 3)
+	o := sink.objects[2]
+	assert.True(t, strings.HasSuffix(o.Key, ManifestExtension), o.Key)
+	assert.Equal(t, "application/json", o.ContentType)
+	var m Manifest
+	require.NoError(t, json.Unmarshal(o.Data, &m))
+	require.Len(t, m.Chunks, 1)
+	assert.Equal(t, sink.objects[0].Key, m.Chunks[0].Key)
+	assert.NotEmpty(t, m.Chunks[0].ChecksumSHA256)
+	assert.True(t, m.Complete)
+}
+
+func TestSinkManifestRejectsRecordSinks(t *testing.T) {
+	for _, sink := range []Sink{
+		CloudWatchLogsSink{},
+		&CloudWatchLogsSink{},
+		FirehoseSink{},
+		&FirehoseSink{},
+	} {
+		_, err := NewWithSink(sink, WithoutBatchFrequency(), WithManifest())
+		assert.ErrorContains(t, err, "manifests cannot be combined", "%T", sink)
+	}
+	_, err := NewWithSink(FileSink{Dir: t.TempDir()}, WithoutBatchFrequency(), WithManifest())
+	assert.NoError(t, err)
+}
+
+func TestObjectSplit(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := GzipCodec{}.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("a||b||||"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	records, err := Object{Data: buf.Bytes(), Codec: GzipCodec{}, Delimiter: []byte("||")}.Split()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), {}}, records)
+
+	records, err = Object{Codec: NoneCodec{}, Delimiter: []byte("\n")}.Split()
+	require.NoError(t, err)
+	assert.Empty(t, records)
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	l, err := NewWithSink(FileSink{Dir: dir}, WithoutBatchFrequency(), WithPrefix("logs/"))
+	require.NoError(t, err)
+	require.NoError(t, l.WriteRecord([]byte("hello")))
+	require.NoError(t, l.Close(context.Background()))
+
+	var files []string
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	}))
+	require.Len(t, files, 1)
+	rel, err := filepath.Rel(dir, files[0])
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(filepath.ToSlash(rel), "logs/"), rel)
+
+	f, err := os.Open(files[0])
+	require.NoError(t, err)
+	defer f.Close()
+	r, err := GzipCodec{}.NewReader(f)
+	require.NoError(t, err)
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(data))
+}
+
+func TestS3Sink(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	sink := S3Sink{Client: client, Bucket: "foundry-curation-test"}
+	err := sink.Put(context.Background(), Object{
+		Key:             "logs/a.gz",
+		Data:            []byte("data"),
+		ContentType:     "application/x-ndjson",
+		ContentEncoding: "gzip",
+		Metadata:        map[string]string{"service": "test"},
+		Last:            time.Now(),
+	})
+	require.NoError(t, err)
+
+	input := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "foundry-curation-test", aws.ToString(input.Bucket))
+	assert.Equal(t, "logs/a.gz", aws.ToString(input.Key))
+	assert.Equal(t, "gzip", aws.ToString(input.ContentEncoding))
+	assert.EqualValues(t, 4, aws.ToInt64(input.ContentLength))
+	assert.NotEmpty(t, aws.ToString(input.ChecksumSHA256))
+	assert.Equal(t, "test", input.Metadata["service"])
+	assert.Empty(t, input.ServerSideEncryption)
+	assert.Nil(t, input.Tagging)
+}
+
+func TestUploadsUseS3Sink(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(),
+		WithServerSideEncryption(types.ServerSideEncryptionAwsKms, "key-id"),
+		WithStorageClass(types.StorageClassStandardIa),
+		WithObjectTags(map[string]string{"team": "curation"}))
+	require.NoError(t, err)
+	assert.IsType(t, S3Sink{}, l.sink)
+
+	require.NoError(t, l.WriteRecord([]byte("hello")))
+	l.Sync()
+
+	input := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "foundry-curation-test", aws.ToString(input.Bucket))
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+	assert.Equal(t, "key-id", aws.ToString(input.SSEKMSKeyId))
+	assert.Equal(t, types.StorageClassStandardIa, input.StorageClass)
+	assert.Equal(t, "team=curation", aws.ToString(input.Tagging))
+	assert.Equal(t, "hello\n", readBody(t, input))
+}
@@ -0,0 +1,216 @@
+package s3logger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	spoolTmpSuffix  = ".tmp"
+	spoolInfoSuffix = ".info"
+)
+
+// WithSpoolDir persists every chunk in dir before it is uploaded. A chunk is
+// removed from dir only after a successful upload, chunks left over from a
+// previous process are uploaded again by New.
+func WithSpoolDir(dir string) Option {
+	return func(l *S3Logger) error {
+		l.spoolDir = dir
+		return nil
+	}
+}
+
+// defaultSpoolRetry is the backoff between drains of the spool dir after a
+// failed upload.
+var defaultSpoolRetry = RetryPolicy{
+	InitialBackoff: time.Second,
+	MaxBackoff:     5 * time.Minute,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// WithSpoolRetryBackoff sets the backoff between retries of spooled chunks
+// after a failed upload, it starts at initial and doubles up to maxBackoff.
+// It defaults to 1s up to 5m.
+func WithSpoolRetryBackoff(initial, maxBackoff time.Duration) Option {
+	return func(l *S3Logger) error {
+		if initial <= 0 || maxBackoff < initial {
+			return errors.New("spool retry backoff must be positive and not exceed its maximum")
+		}
+		l.spoolRetry.InitialBackoff = initial
+		l.spoolRetry.MaxBackoff = maxBackoff
+		return nil
+	}
+}
+
+func (l *S3Logger) openSpool() error {
+	err := os.MkdirAll(l.spoolDir, 0o755)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(l.spoolDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		// incomplete chunk of a process that died while spooling
+		if strings.HasSuffix(e.Name(), spoolTmpSuffix) {
+			_ = os.Remove(filepath.Join(l.spoolDir, e.Name()))
+		}
+		// info of a chunk that was never written
+		if name, ok := strings.CutSuffix(e.Name(), spoolInfoSuffix); ok {
+			if _, err := os.Stat(filepath.Join(l.spoolDir, name)); errors.Is(err, fs.ErrNotExist) {
+				_ = os.Remove(filepath.Join(l.spoolDir, e.Name()))
+			}
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.spoolCancel = cancel
+	l.spoolSignal = make(chan struct{}, 1)
+	l.spoolStopped = make(chan struct{})
+	l.notifySpool()
+	go l.runSpool(ctx)
+	return nil
+}
+
+// runSpool drains the spool dir whenever a chunk was spooled. After a failed
+// drain it retries with backoff, so spooled chunks are uploaded once the
+// destination recovers even if no new records are written.
+func (l *S3Logger) runSpool(ctx context.Context) {
+	defer close(l.spoolStopped)
+	retry := time.NewTimer(0)
+	retry.Stop()
+	defer retry.Stop()
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-l.spoolSignal:
+		case <-retry.C:
+		}
+		err := l.drainSpool(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			failures = 0
+			retry.Stop()
+			continue
+		}
+		l.backgroundError(err)
+		failures++
+		retry.Reset(l.spoolRetry.backoff(failures))
+	}
+}
+
+// spool writes the chunk atomically to the spool dir and wakes up the
+// uploader. The chunk info is kept in a file next to it.
+func (l *S3Logger) spool(key string, data []byte, info chunkInfo) error {
+	name := filepath.Join(l.spoolDir, url.PathEscape(key))
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(name+spoolInfoSuffix, infoData)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(name, data)
+	if err != nil {
+		_ = os.Remove(name + spoolInfoSuffix)
+		return err
+	}
+	l.notifySpool()
+	return nil
+}
+
+func writeFileAtomic(name string, data []byte) error {
+	f, err := os.Create(name + spoolTmpSuffix)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(name+spoolTmpSuffix, name)
+	}
+	if err != nil {
+		_ = os.Remove(name + spoolTmpSuffix)
+	}
+	return err
+}
+
+// spoolChunk spools a chunk cut from the logger.
+func (l *S3Logger) spoolChunk(c *chunk) error {
+	info := c.info
+	info.Time = l.now()
+	err := l.spool(l.key(info.Time), c.buffer.Bytes(), info)
+	if err == nil {
+		l.manifestChunkStarted(info.Time)
+	}
+	return err
+}
+
+func (l *S3Logger) notifySpool() {
+	select {
+	case l.spoolSignal <- struct{}{}:
+	default:
+	}
+}
+
+// drainSpool uploads all spooled chunks in key order and stops at the first
+// failure, the remaining chunks are retried on the next notification.
+func (l *S3Logger) drainSpool(ctx context.Context) error {
+	entries, err := os.ReadDir(l.spoolDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasSuffix(e.Name(), spoolTmpSuffix) || strings.HasSuffix(e.Name(), spoolInfoSuffix) {
+			continue
+		}
+		key, err := url.PathUnescape(e.Name())
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(l.spoolDir, e.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		// chunks spooled by older versions have no info
+		var info chunkInfo
+		infoData, err := os.ReadFile(path + spoolInfoSuffix)
+		if err == nil {
+			_ = json.Unmarshal(infoData, &info)
+		}
+		if info.Time.IsZero() {
+			info.Time = l.now()
+		}
+		entry, err := l.upload(ctx, key, data, info)
+		if err != nil {
+			return fmt.Errorf("could not upload spooled chunk %s: %w", key, err)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(path + spoolInfoSuffix)
+		l.backgroundError(l.manifestChunkUploaded(ctx, info.Time, entry))
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package s3logger
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolUploadsAndRemovesChunk(t *testing.T) {
+	dir := t.TempDir()
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("spooled line\n")))
+	l.Sync()
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	reader, err := gzip.NewReader(rs.Body)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "spooled line\n", string(data))
+
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(dir)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSpoolResendsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	failing := s3MockClient{putErr: errors.New("s3 unavailable")}
+	l, err := New("foundry-curation-test", failing, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+
+	require.NoError(t, l.Write([]byte("survives restart\n")))
+	l.Sync()
+	assert.Error(t, l.Close(context.Background()))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	key := entries[0].Name()
+	assert.Equal(t, key+spoolInfoSuffix, entries[1].Name())
+
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err = New("foundry-curation-test", client, WithoutBatchFrequency(), WithSpoolDir(dir))
+	require.NoError(t, err)
+	defer l.Close(context.Background())
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, key, url.PathEscape(*rs.Key))
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(dir)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSpoolRetriesWithoutNewChunks(t *testing.T) {
+	dir := t.TempDir()
+	client := &flakyS3Client{s3MockClient: s3MockClient{debugChan: make(chan interface{}, 1)}, failures: 2}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithSpoolDir(dir),
+		WithSpoolRetryBackoff(5*time.Millisecond, 10*time.Millisecond))
+	require.NoError(t, err)
+	defer l.Close(context.Background())
+
+	require.NoError(t, l.Write([]byte("retried from spool\n")))
+	require.NoError(t, l.Sync())
+
+	select {
+	case <-client.debugChan:
+	case <-time.After(time.Second):
+		t.Fatal("spooled chunk was not retried")
+	}
+	assert.Equal(t, int32(3), client.calls.Load())
+
+	_, err = New("foundry-curation-test", client, WithSpoolRetryBackoff(time.Second, time.Millisecond))
+	assert.Error(t, err)
+}
@@ -0,0 +1,47 @@
+package s3logger
+
+import (
+	"context"
+	"io"
+)
+
+// Writer adapts an S3Logger to io.WriteCloser and zapcore.WriteSyncer.
+type Writer struct {
+	logger *S3Logger
+	write  func(p []byte) error
+}
+
+var _ io.WriteCloser = (*Writer)(nil)
+
+// NewWriter returns a Writer passing the written bytes unchanged, e.g. for
+// io.Copy.
+func NewWriter(l *S3Logger) *Writer {
+	return &Writer{logger: l, write: l.Write}
+}
+
+// NewRecordWriter returns a Writer treating every Write as one record, as
+// written by log.Logger, slog, zap or zerolog. Record delimiters within a
+// Write, like the newlines of a multi-line log.Logger message, are escaped.
+func NewRecordWriter(l *S3Logger) *Writer {
+	return &Writer{logger: l, write: func(p []byte) error {
+		return l.WriteRecord(l.escapeDelimiter(p))
+	}}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	err := w.write(p)
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Sync uploads the buffered data.
+func (w *Writer) Sync() error {
+	return w.logger.Sync()
+}
+
+// Close closes the underlying logger.
+func (w *Writer) Close() error {
+	return w.logger.Close(context.Background())
+}
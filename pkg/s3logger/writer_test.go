@@ -0,0 +1,63 @@
+package s3logger
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterWithStdLog(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency())
+	require.NoError(t, err)
+
+	logger := log.New(NewRecordWriter(l), "", 0)
+	logger.Print("first")
+	logger.Print("second\nwith stack\n\tat main.go:1")
+	require.NoError(t, NewRecordWriter(l).Close())
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "first\nsecond\\nwith stack\\n\tat main.go:1\n", readBody(t, rs))
+}
+
+func TestRecordWriterEscapesDelimiter(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency(), WithRecordDelimiter([]byte("|")))
+	require.NoError(t, err)
+
+	w := NewRecordWriter(l)
+	_, err = w.Write([]byte("a|b|"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("c"))
+	require.NoError(t, err)
+	require.NoError(t, w.Sync())
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, "a b|c|", readBody(t, rs))
+}
+
+func TestWriterWithIOCopy(t *testing.T) {
+	client := s3MockClient{debugChan: make(chan interface{}, 1)}
+	l, err := New("foundry-curation-test", client, WithoutBatchFrequency())
+	require.NoError(t, err)
+
+	input := strings.Repeat("copied line\n", 10_000)
+	w := NewWriter(l)
+	n, err := io.Copy(w, strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(input)), n)
+	require.NoError(t, w.Sync())
+
+	rs := (<-client.debugChan).(*s3.PutObjectInput)
+	assert.Equal(t, input, readBody(t, rs))
+
+	require.NoError(t, w.Close())
+	_, err = w.Write([]byte("closed"))
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,14 @@
+// Package zapwriter writes zap log entries to an s3logger.S3Logger.
+package zapwriter
+
+import (
+	"go.uber.org/zap/zapcore"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+// NewWriteSyncer returns a zapcore.WriteSyncer writing every log entry as
+// one record.
+func NewWriteSyncer(l *s3logger.S3Logger) zapcore.WriteSyncer {
+	return s3logger.NewRecordWriter(l)
+}
@@ -0,0 +1,42 @@
+package zapwriter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+type recordingSink struct {
+	records [][]byte
+}
+
+func (s *recordingSink) Put(_ context.Context, o s3logger.Object) error {
+	records, err := o.Split()
+	s.records = append(s.records, records...)
+	return err
+}
+
+func TestWriteSyncer(t *testing.T) {
+	sink := &recordingSink{}
+	l, err := s3logger.NewWithSink(sink, s3logger.WithoutBatchFrequency())
+	require.NoError(t, err)
+
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), NewWriteSyncer(l), zap.InfoLevel)
+	logger := zap.New(core)
+	logger.Info("zap message", zap.Int("answer", 42))
+	require.NoError(t, logger.Sync())
+
+	require.Len(t, sink.records, 1)
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(sink.records[0], &entry))
+	assert.Equal(t, "zap message", entry["msg"])
+	assert.Equal(t, float64(42), entry["answer"])
+}
@@ -0,0 +1,14 @@
+// Package zerologwriter writes zerolog events to an s3logger.S3Logger.
+package zerologwriter
+
+import (
+	"github.com/rs/zerolog"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+// NewLogger returns a zerolog.Logger with timestamps writing every event as
+// one record.
+func NewLogger(l *s3logger.S3Logger) zerolog.Logger {
+	return zerolog.New(s3logger.NewRecordWriter(l)).With().Timestamp().Logger()
+}
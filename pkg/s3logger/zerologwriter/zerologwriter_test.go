@@ -0,0 +1,40 @@
+package zerologwriter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/spring-media/curation-pkgs-public/pkg/s3logger"
+)
+
+type recordingSink struct {
+	records [][]byte
+}
+
+func (s *recordingSink) Put(_ context.Context, o s3logger.Object) error {
+	records, err := o.Split()
+	s.records = append(s.records, records...)
+	return err
+}
+
+func TestLogger(t *testing.T) {
+	sink := &recordingSink{}
+	l, err := s3logger.NewWithSink(sink, s3logger.WithoutBatchFrequency())
+	require.NoError(t, err)
+
+	logger := NewLogger(l)
+	logger.Warn().Str("component", "test").Msg("zerolog message")
+	require.NoError(t, l.Sync())
+
+	require.Len(t, sink.records, 1)
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(sink.records[0], &entry))
+	assert.Equal(t, "zerolog message", entry["message"])
+	assert.Equal(t, "warn", entry["level"])
+	assert.Equal(t, "test", entry["component"])
+	assert.Contains(t, entry, "time")
+}